@@ -3,89 +3,84 @@ package acme
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
-	"encoding/pem"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 
 	"github.com/caasmo/restinpieces/config"
 	"github.com/caasmo/restinpieces/db"
-	"github.com/pelletier/go-toml/v2"
 
-	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/challenge"
 	"github.com/go-acme/lego/v4/challenge/dns01"
 	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+	"github.com/go-acme/lego/v4/providers/dns/route53"
 	"github.com/go-acme/lego/v4/registration"
 )
 
 const (
-	ScopeConfig           = "acme_config"        // Scope for storing ACME handler config (email, domains, keys)
-	ScopeAcmeCertificate  = "acme_certificate"   // Scope for saving obtained cert+key
+	ScopeConfig           = "acme_config"      // Scope for storing ACME handler config (email, domains, keys)
+	ScopeAcmeCertificate  = "acme_certificate" // Scope for saving obtained cert+key
 	DNSProviderCloudflare = "cloudflare"
+	DNSProviderRoute53    = "route53"
 )
 
-type DNSProvider struct {
-	APIToken string
-}
-
-type Config struct {
-	// used by Let's Encrypt (the ACME CA) primarily for notifications. They
-	// will send reminders about certificate expiry and potentially other
-	// important account notices
-	Email string
-	// Obtaining wildcard certificates (e.g., *.example.com) requires using the
-	// dns-01 challenge type. ACME best practices (and Let's Encrypt's policy)
-	// require you to also include the base domain (example.com) in the same
-	// certificate request Domains = ["example.com", "*.example.com"]
-	Domains      []string
-	DNSProviders map[string]DNSProvider // Map provider name (e.g., "cloudflare") to its config
-	// The Let's Encrypt staging environment
-	// (https://acme-staging-v02.api.letsencrypt.org/directory) and the
-	// production environment (https://acme-v02.api.letsencrypt.org/directory)
-	// are completely separate. Separate Accounts: An account registered on the
-	// staging environment (identified by your AcmeAccountPrivateKey) is not
-	// recognized by the production environment, and vice-versa. You need to
-	// register your account key on each environment you interact with
-	CADirectoryURL        string
-	ActiveDNSProvider     string // Name of the provider key in DNSProviders map to use
-    // openssl genpkey -algorithm Ed25519 -out acme_account_ed25519.key
-    // this is account main identifier for acme providers 
-    // For toml manual insertion the Multiline Literal String ('''...''') is
-    // the best choice.
-	AcmeAccountPrivateKey string
-}
-
 // Cert defines the structure for the TOML config to be saved.
 // Note: TOML tags are not strictly needed here as we marshal the whole struct.
 type Cert struct {
-	Identifier       string    // Identifier for the cert request (e.g., primary domain)
-	Domains          []string  // List of all domains covered
-	CertificateChain string    // PEM encoded certificate chain
-	PrivateKey       string    // PEM encoded private key for the cert (Sensitive!)
-	IssuedAt         time.Time // UTC timestamp of issuance
-	ExpiresAt        time.Time // UTC timestamp of expiry
+	Identifier        string    // Identifier for the cert request (e.g., primary domain)
+	Domains           []string  // List of all domains covered
+	CertificateChain  string    // PEM encoded certificate chain
+	PrivateKey        string    // PEM encoded private key for the cert (Sensitive!)
+	IssuedAt          time.Time // UTC timestamp of issuance
+	ExpiresAt         time.Time // UTC timestamp of expiry
+	SerialNumber      string    // Hex encoded serial number of the leaf
+	IssuerCN          string    // Common name of the issuing CA
+	FingerprintSHA256 string    // Hex encoded SHA-256 of the leaf DER
+	SPKISHA256        string    // Base64 encoded SHA-256 of the leaf SubjectPublicKeyInfo (pin-sha256)
+	KeyAlgorithm      string    // Leaf public key algorithm (e.g., "ECDSA P-256", "RSA 2048")
+	RevokedAt         time.Time // UTC timestamp of revocation, zero if not revoked
+	RevocationReason  uint      // RFC 5280 CRL reason code used for the revocation
+	SelfSigned        bool      // Bootstrap placeholder from NewSelfSignedCert, always due for renewal
+	SCTLogIDs         []string  // Base64 CT log IDs of the SCTs embedded in the leaf
+	// FingerprintSHA256 of the certificate this one replaced, the target of
+	// SecureCertStore.Rollback
+	PreviousFingerprintSHA256 string
 }
 
+// CertRenewalHandler is the restinpieces job handler renewing the
+// certificate of its Config with a Renewer.
 type CertRenewalHandler struct {
-	config            *Config
-	secureConfigStore config.SecureStore
-	logger            *slog.Logger
+	*Renewer
 }
 
-func NewCertRenewalHandler(cfg *Config, store config.SecureStore, logger *slog.Logger) *CertRenewalHandler {
-	if cfg == nil || store == nil || logger == nil {
-		panic("NewCertRenewalHandler: received nil config, store, or logger")
+// NewCertRenewalHandler returns the handler renewing the certificate of cfg
+// into store. It fails if any argument is nil.
+func NewCertRenewalHandler(cfg *Config, store config.SecureStore, logger *slog.Logger) (*CertRenewalHandler, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("NewCertRenewalHandler: received nil logger")
 	}
-	return &CertRenewalHandler{
-		config:            cfg,
-		secureConfigStore: store,
-		logger:            logger.With("job_handler", "cert_renewal"),
+	r, err := NewRenewer(cfg, store, logger.With("job_handler", "cert_renewal"))
+	if err != nil {
+		return nil, err
 	}
+	return &CertRenewalHandler{Renewer: r}, nil
+}
+
+// Handle executes the certificate renewal logic, logging the RenewalResult
+// and saving it to ScopeAcmeResults.
+func (h *CertRenewalHandler) Handle(ctx context.Context, job db.Job) error {
+	result, err := h.Renew(ctx, job)
+	h.recordResult(result)
+	return err
 }
 
 // AcmeUser implements lego's registration.User interface (internal helper type)
@@ -103,75 +98,153 @@ func (u *AcmeUser) GetRegistration() *registration.Resource { return u.Registrat
 //	It's fully supported and often preferred for its modern design.
 func (u *AcmeUser) GetPrivateKey() crypto.PrivateKey { return u.PrivateKey }
 
-// Handle executes the certificate renewal logic.
-func (h *CertRenewalHandler) Handle(ctx context.Context, job db.Job) error {
-	cfg := h.config // Use the handler's config
-
-	h.logger.Info("Attempting certificate renewal process", "domains", cfg.Domains)
+// Renew runs the renewal of job, as restricted by its RenewalPayload, and
+// returns what it did. The result is never nil; on failure its Error is
+// the returned error. Runs skipped by the payload are not reported to the
+// RenewalObserver chain, but every job, skipped or not, pings the Heartbeat
+// of the config.
+func (h *Renewer) Renew(ctx context.Context, job db.Job) (result *RenewalResult, err error) {
+	h = h.current()
+	// The duration is measured with the monotonic wall clock (see Clock).
+	start := time.Now()
+	result = &RenewalResult{StartedAt: h.clock.Now().UTC()}
+	defer func() {
+		result.DurationSeconds = time.Since(start).Seconds()
+		if err != nil {
+			result.Error = err.Error()
+		}
+		h.heartbeat(ctx, err)
+	}()
 
-	// --- Lego Client Setup (using cfg) ---
-	// Parse ACME Account Key (expecting PEM format)
-	acmePrivateKey, err := certcrypto.ParsePEMPrivateKey([]byte(cfg.AcmeAccountPrivateKey))
+	payload, err := ParseRenewalPayload(job)
+	if err != nil {
+		h.logger.Error("Invalid renewal job payload", "job_id", job.ID, "error", err)
+		return result, err
+	}
+	cfg, err := payload.apply(h.config)
 	if err != nil {
-		h.logger.Error("Failed to parse ACME account private key from config", "error", err)
-		return fmt.Errorf("failed to parse ACME account private key: %w", err)
+		h.logger.Error("Renewal job does not match the ACME configuration", "job_id", job.ID, "error", err)
+		return result, err
+	}
+	result.Domains = cfg.Domains
+	if len(cfg.Domains) > 0 {
+		result.Identifier = cfg.Domains[0]
 	}
+	if payload != nil && (payload.DryRun || !payload.Force) {
+		if err := cfg.Validate(); err != nil {
+			h.logger.Error("Invalid ACME configuration", "error", err)
+			return result, err
+		}
+		due, reason, err := h.due(cfg)
+		if err != nil {
+			return result, err
+		}
+		result.Reason = reason
+		if payload.DryRun {
+			result.DryRun = true
+			h.logger.Info("Dry run, not renewing", "identifier", cfg.Domains[0], "due", due, "force", payload.Force, "reason", reason)
+			return result, nil
+		}
+		if !due {
+			h.logger.Info("Renewal not due, nothing to do", "identifier", cfg.Domains[0], "reason", reason)
+			return result, nil
+		}
+		h.logger.Info("Renewal due", "identifier", cfg.Domains[0], "reason", reason)
+	}
+	if cfg != h.config {
+		// Domains of the payload: a copy of the Renewer runs with them.
+		override := *h
+		override.config = cfg
+		h = &override
+	}
+	return result, h.obtain(ctx, job, result)
+}
 
-	acmeUser := AcmeUser{Email: cfg.Email, PrivateKey: acmePrivateKey}
-	legoConfig := lego.NewConfig(&acmeUser)
-	legoConfig.CADirURL = cfg.CADirectoryURL
-	legoConfig.Certificate.KeyType = certcrypto.EC256 // Request ECDSA certs
+// obtain obtains, saves and deploys a new certificate into result,
+// reporting the outcome to the RenewalObserver chain. Once the certificate
+// is saved the run succeeds: a failed deployment is recorded in the result
+// and the deployment report and reported to the observers, but not returned,
+// as a retried job would order another certificate from the CA.
+func (h *Renewer) obtain(ctx context.Context, job db.Job, result *RenewalResult) (err error) {
+	cfg := h.config // Use the handler's config
 
-	legoClient, err := lego.NewClient(legoConfig)
-	if err != nil {
-		h.logger.Error("Failed to create ACME client", "error", err)
-		return fmt.Errorf("failed to create ACME client: %w", err)
+	// The identifier of the obtained certificate is its first domain.
+	var identifier string
+	if len(cfg.Domains) > 0 {
+		identifier = cfg.Domains[0]
+	}
+	run := RenewalRun{Job: job, Identifier: identifier, Domains: cfg.Domains, StartedAt: h.clock.Now()}
+	observers := h.observerChain()
+	var deployErr error
+	defer func() {
+		failure := err
+		if failure == nil {
+			failure = deployErr
+		}
+		if failure != nil {
+			h.emit(ctx, EventRenewalFailed, identifier, func(e *Event) { e.Err = failure })
+			for _, o := range observers {
+				o.OnFailure(ctx, run, failure)
+			}
+			return
+		}
+		for _, o := range observers {
+			o.OnSuccess(ctx, run, result.Cert)
+		}
+	}()
+	for _, o := range observers {
+		o.OnStart(ctx, run)
 	}
+	h.emit(ctx, EventRenewalStarted, identifier, nil)
 
-	// --- DNS Provider Setup (using cfg.DNSProviders map) ---
-	providerName := cfg.ActiveDNSProvider
-	if providerName == "" {
-		err := fmt.Errorf("ActiveDNSProvider field is missing or empty in ACME configuration")
-		h.logger.Error(err.Error())
+	if err := cfg.Validate(); err != nil {
+		h.logger.Error("Invalid ACME configuration", "error", err)
 		return err
 	}
-	h.logger.Debug("Using configured DNS provider", "provider_name", providerName)
-
-	providerConfig, ok := cfg.DNSProviders[providerName]
-	if !ok {
-		err := fmt.Errorf("configured ActiveDNSProvider '%s' not found in DNSProviders map", providerName)
-		h.logger.Error(err.Error())
+	// Fail before the CA issues a certificate that could not be saved.
+	if _, err := h.certWriter(); err != nil {
+		h.logger.Error("Invalid ACME configuration", "error", err)
 		return err
 	}
 
-	// Get the DNS provider instance using the helper function
-	dnsProvider, err := getDNSProvider(providerName, providerConfig, h.logger)
+	h.logger.Info("Attempting certificate renewal process", "domains", cfg.Domains)
+
+	// --- ACME Client Setup (using cfg) ---
+	defer h.withLegoLogs(cfg)()
+	client, err := h.newClient(cfg)
 	if err != nil {
-		// Error already logged by getDNSProvider or from config checks
-		return err // Return the error directly
+		h.logger.Error("Failed to set up ACME client", "error", err)
+		return err
 	}
+	defer client.Close()
 
-	// Set DNS challenge provider with a suitable timeout
-	err = legoClient.Challenge.SetDNS01Provider(dnsProvider, dns01.AddDNSTimeout(10*time.Minute))
-	if err != nil {
-		h.logger.Error("Failed to set DNS01 provider", "provider", providerName, "error", err)
-		return fmt.Errorf("failed to set DNS01 provider: %w", err)
+	// --- DNS Provider Setup (using cfg.DNSProviders map) ---
+	timer := &phaseTimer{}
+	if cfg.IssuanceMode == IssuanceModeDev {
+		h.logger.Warn("Issuing from the local development CA, no ACME server or DNS provider is contacted")
+	} else if err := h.setupDNS(ctx, cfg, client, identifier, timer); err != nil {
+		return err
 	}
 
 	// --- Register/Retrieve ACME Account ---
 	// We call Register on every run. This function is idempotent:
 	// - If the account key is new, it registers a new account with the CA.
 	// - If the account key already exists, it retrieves the existing account details.
-	// Persisting the registration details (acmeUser.Registration) would add complexity
+	// Persisting the registration details would add complexity
 	// for only minor efficiency gains (saving one network call).
-	// Register needs TermsOfServiceAgreed: true.
-	reg, err := legoClient.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	accountURI, err := client.Register()
 	if err != nil {
-		h.logger.Error("ACME account registration/retrieval failed", "email", acmeUser.Email, "error", err)
-		return fmt.Errorf("ACME registration/retrieval failed for %s: %w", acmeUser.Email, err)
+		h.logger.Error("ACME account registration/retrieval failed", "email", cfg.Email, "error", err)
+		return fmt.Errorf("ACME registration/retrieval failed for %s: %w", cfg.Email, err)
+	}
+	h.logger.Info("ACME account registered/retrieved successfully", "email", cfg.Email, "account_uri", accountURI)
+
+	if cfg.PreHook.Command != "" {
+		if err := h.runHook(ctx, hookPre, cfg.PreHook, nil); err != nil {
+			h.logger.Error("Pre hook failed, aborting renewal", "error", err)
+			return err
+		}
 	}
-	acmeUser.Registration = reg // Store registration details in the temporary user object
-	h.logger.Info("ACME account registered/retrieved successfully", "email", acmeUser.Email, "account_uri", reg.URI)
 
 	// --- Obtain Certificate ---
 	request := certificate.ObtainRequest{
@@ -180,32 +253,134 @@ func (h *CertRenewalHandler) Handle(ctx context.Context, job db.Job) error {
 	}
 
 	// This is the main blocking call that performs the ACME flow (order, challenge, finalize)
-	resource, err := legoClient.Certificate.Obtain(request)
+	timer.begin()
+	resource, err := client.Obtain(request)
+	h.recordTimings(timer.timings(identifier, err == nil))
 	if err != nil {
 		h.logger.Error("Failed to obtain certificate", "domains", request.Domains, "error", err)
-		// Consider checking for specific lego errors if needed
-		return fmt.Errorf("failed to obtain certificate for domains %v: %w", request.Domains, err)
+		return fmt.Errorf("failed to obtain certificate for domains %v: %w", request.Domains, classifyObtainError(err, h.clock.Now()))
 	}
+	// The key is kept in the saved Cert; the PEM of lego is not needed after.
+	defer Zeroize(resource.PrivateKey)
 	h.logger.Info("Successfully obtained certificate", "domains", request.Domains, "certificate_url", resource.CertURL)
+	// lego only issues once the CA validated the challenge of every domain.
+	for _, domain := range request.Domains {
+		h.emit(ctx, EventChallengeValid, identifier, func(e *Event) { e.Domain = domain })
+	}
+	h.emit(ctx, EventCertObtained, identifier, func(e *Event) { e.CertURL = resource.CertURL })
 
-	if err := h.saveCertificate(resource, h.logger); err != nil {
+	saved, err := h.saveCertificate(ctx, resource, h.logger)
+	if err != nil {
 		return err
 	}
+	result.Renewed = true
+	result.Cert = saved
+	result.ExpiresAt = saved.ExpiresAt
+	result.FingerprintSHA256 = saved.FingerprintSHA256
+	result.CertURL = resource.CertURL
+	h.metrics.setExpiry(saved)
+	h.emit(ctx, EventCertSaved, identifier, func(e *Event) { e.Cert = saved })
+	if deployErr = h.deploy(ctx, saved); deployErr != nil {
+		result.DeployError = deployErr.Error()
+		h.logger.Error("Certificate saved, but not fully deployed; not failing the job so it is not ordered again", "identifier", identifier, "error", deployErr)
+		return nil
+	}
 
 	h.logger.Info("Successfully processed certificate renewal job.", "domains", request.Domains)
 	return nil
 }
 
+// setupDNS makes client solve dns-01 challenges with the active DNS provider
+// of cfg, observed by timer.
+func (h *Renewer) setupDNS(ctx context.Context, cfg *Config, client AcmeClient, identifier string, timer *phaseTimer) error {
+	providerName := cfg.ActiveDNSProvider
+	dnsProvider, err := activeDNSProvider(cfg, h.logger)
+	if err != nil {
+		// Error already logged by activeDNSProvider
+		return err // Return the error directly
+	}
+	if providerName == DNSProviderCloudflare {
+		if err := h.preflightCloudflare(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	dnsProvider = h.observeProvider(ctx, dnsProvider, identifier, timer)
+
+	// Set DNS challenge provider with the configured propagation timeout
+	timeout, err := cfg.dnsTimeout()
+	if err != nil {
+		return err
+	}
+	err = client.SetDNS01Provider(dnsProvider, dns01.AddDNSTimeout(timeout), timer.preCheckOption())
+	if err != nil {
+		h.logger.Error("Failed to set DNS01 provider", "provider", providerName, "error", err)
+		return fmt.Errorf("failed to set DNS01 provider: %w", err)
+	}
+	return nil
+}
+
+// newLegoClient parses the ACME account key of cfg and creates a lego client
+// for the configured CA directory. The returned user has no registration yet.
+func newLegoClient(cfg *Config) (*lego.Client, *AcmeUser, error) {
+	acmePrivateKey, err := ParseAccountKey(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyType, err := cfg.certKeyType()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acmeUser := &AcmeUser{Email: cfg.Email, PrivateKey: acmePrivateKey}
+	legoConfig := lego.NewConfig(acmeUser)
+	legoConfig.CADirURL = cfg.CADirectoryURL
+	legoConfig.UserAgent = userAgent(cfg)
+	legoConfig.Certificate.KeyType = keyType
+
+	legoClient, err := lego.NewClient(legoConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create ACME client: %w", err)
+	}
+	return legoClient, acmeUser, nil
+}
+
+// activeDNSProvider resolves cfg.ActiveDNSProvider against cfg.DNSProviders
+// and returns the configured lego provider.
+func activeDNSProvider(cfg *Config, logger *slog.Logger) (challenge.Provider, error) {
+	providerName := cfg.ActiveDNSProvider
+	if providerName == "" {
+		err := fmt.Errorf("ActiveDNSProvider field is missing or empty in ACME configuration")
+		logger.Error(err.Error())
+		return nil, err
+	}
+	logger.Debug("Using configured DNS provider", "provider_name", providerName)
+
+	providerConfig, ok := cfg.DNSProviders[providerName]
+	if !ok {
+		err := fmt.Errorf("configured ActiveDNSProvider '%s' not found in DNSProviders map", providerName)
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	// Get the DNS provider instance using the helper function
+	return getDNSProvider(providerName, providerConfig, logger)
+}
+
 // getDNSProvider selects and configures the appropriate lego DNS challenge provider
 // based on the provided name and configuration.
 func getDNSProvider(providerName string, providerConfig DNSProvider, logger *slog.Logger) (challenge.Provider, error) {
 	var dnsProvider challenge.Provider
-	var err error
+
+	creds, err := providerConfig.resolvedCredentials()
+	if err != nil {
+		logger.Error("Failed to read DNS provider secret", "provider_name", providerName, "error", err)
+		return nil, fmt.Errorf("failed to read %s credentials: %w", providerName, err)
+	}
 
 	switch providerName {
 	case DNSProviderCloudflare:
 		cfLegoConfig := cloudflare.NewDefaultConfig()
-		cfLegoConfig.AuthToken = providerConfig.APIToken
+		cfLegoConfig.AuthToken = creds["APIToken"]
 		// Add other CF config if needed (AuthEmail, AuthKey, ZoneToken etc.) based on your auth method
 
 		var cfProvider *cloudflare.DNSProvider // Declare cfProvider here
@@ -215,6 +390,20 @@ func getDNSProvider(providerName string, providerConfig DNSProvider, logger *slo
 			return nil, fmt.Errorf("failed to create Cloudflare provider: %w", err)
 		}
 		dnsProvider = cfProvider
+	case DNSProviderRoute53:
+		r53LegoConfig := route53.NewDefaultConfig()
+		r53LegoConfig.AccessKeyID = creds["AccessKeyID"]
+		r53LegoConfig.SecretAccessKey = creds["SecretAccessKey"]
+		r53LegoConfig.Region = creds["Region"]
+		r53LegoConfig.HostedZoneID = creds["HostedZoneID"]
+
+		var r53Provider *route53.DNSProvider
+		r53Provider, err = route53.NewDNSProviderConfig(r53LegoConfig)
+		if err != nil {
+			logger.Error("Failed to create Route 53 DNS provider", "error", err)
+			return nil, fmt.Errorf("failed to create Route 53 provider: %w", err)
+		}
+		dnsProvider = r53Provider
 	default:
 		err := fmt.Errorf("unsupported DNS provider configured: %q", providerName)
 		logger.Error(err.Error())
@@ -224,50 +413,106 @@ func getDNSProvider(providerName string, providerConfig DNSProvider, logger *slo
 	return dnsProvider, nil
 }
 
-func (h *CertRenewalHandler) saveCertificate(resource *certificate.Resource, logger *slog.Logger) error {
-	// 1. Parse the certificate to get expiry and issue dates
-	block, _ := pem.Decode(resource.Certificate)
-	if block == nil {
-		err := fmt.Errorf("failed to decode PEM block from obtained certificate chain")
-		logger.Error(err.Error(), "domain", resource.Domain)
-		return err
-	}
-	cert, err := x509.ParseCertificate(block.Bytes) // Parse the leaf certificate
+func (h *Renewer) saveCertificate(ctx context.Context, resource *certificate.Resource, logger *slog.Logger) (*Cert, error) {
+	// 1. Parse the chain, finding the leaf to get expiry and issue dates
+	chain, err := ParseObtainedChain(resource.Certificate, h.config.Domains)
 	if err != nil {
-		err = fmt.Errorf("failed to parse obtained leaf certificate: %w", err)
+		err = fmt.Errorf("malformed certificate chain obtained: %w", err)
 		logger.Error(err.Error(), "domain", resource.Domain)
-		return err
+		return nil, err
 	}
+	cert := chain[0]
 
 	// 2. Create the Cert struct
 	certData := Cert{
-		Identifier:       resource.Domain,              // Use primary domain from resource as identifier
-		Domains:          h.config.Domains,             // Assign the slice directly
-		CertificateChain: string(resource.Certificate), // Full PEM chain
-		PrivateKey:       string(resource.PrivateKey),  // Corresponding PEM private key
-		IssuedAt:         cert.NotBefore.UTC(),         // Use parsed cert's NotBefore
-		ExpiresAt:        cert.NotAfter.UTC(),          // Use parsed cert's NotAfter
+		Identifier:       resource.Domain,             // Use primary domain from resource as identifier
+		Domains:          h.config.Domains,            // Assign the slice directly
+		CertificateChain: string(EncodeChain(chain)),  // Full PEM chain, leaf first
+		PrivateKey:       string(resource.PrivateKey), // Corresponding PEM private key
+		IssuedAt:         cert.NotBefore.UTC(),        // Use parsed cert's NotBefore
+		ExpiresAt:        cert.NotAfter.UTC(),         // Use parsed cert's NotAfter
 	}
-
-	// 4. Marshal the Cert struct to TOML
-	tomlBytes, err := toml.Marshal(certData)
+	setLeafMetadata(&certData, cert)
+
+	// 3. Refuse to replace the stored certificate with one clients would
+	// reject.
+	// Validate also checks resource.PrivateKey against the leaf, catching a
+	// truncated or mismatched key or chain.
+	if err := certData.Validate(h.clock.Now()); err != nil {
+		err = fmt.Errorf("obtained certificate failed validation, keeping the stored one: %w", err)
+		logger.Error(err.Error(), "domain", resource.Domain)
+		return nil, err
+	}
+	if ct := h.config.CertificateTransparency; ct.enabled() {
+		if err := ct.check(cert); err != nil {
+			err = fmt.Errorf("obtained certificate failed the Certificate Transparency check, keeping the stored one: %w", err)
+			logger.Error(err.Error(), "domain", resource.Domain)
+			return nil, err
+		}
+	}
+	roots, err := h.rootPool()
 	if err != nil {
-		logger.Error("Failed to marshal certificate data to TOML", "error", err)
-		return fmt.Errorf("failed to marshal certificate data to TOML: %w", err)
+		err = fmt.Errorf("failed to load TrustedRoots: %w", err)
+		logger.Error(err.Error(), "domain", resource.Domain)
+		return nil, err
+	}
+	if _, err := certData.Verify(roots, h.clock.Now()); err != nil {
+		err = fmt.Errorf("obtained certificate does not chain to a trusted root, keeping the stored one (add the root of a private or staging CA to TrustedRoots): %w", err)
+		logger.Error(err.Error(), "domain", resource.Domain)
+		return nil, err
+	}
+	if r, ok := h.certReader(); ok {
+		if previous, err := r.ByIdentifier(certData.Identifier); err == nil {
+			certData.PreviousFingerprintSHA256 = previous.leafFingerprint()
+			// Not an error: the certificate is valid, but the CA changed
+			// how it issues.
+			if changes := IssuanceChanges(previous, &certData); len(changes) > 0 {
+				logger.Warn("CA issued the certificate differently than the previous one", "identifier", certData.Identifier, "changes", changes)
+				h.emit(ctx, EventIssuanceChanged, certData.Identifier, func(e *Event) { e.Changes = changes })
+			}
+		}
 	}
 
-	// 5. Determine description using parsed expiry date
-	expiryStr := certData.ExpiresAt.Format(time.RFC3339)
-	description := fmt.Sprintf("Obtained certificate for domains: %s (expires %s)", strings.Join(h.config.Domains, ", "), expiryStr)
-
-	// 6. Save using SecureConfigStore
-	logger.Info("Saving obtained certificate configuration", "scope", ScopeAcmeCertificate, "format", "toml", "identifier", certData.Identifier)
-	err = h.secureConfigStore.Save(ScopeAcmeCertificate, tomlBytes, "toml", description)
+	// 4. Persist through the Writer
+	writer, err := h.certWriter()
 	if err != nil {
-		logger.Error("Failed to save certificate config via SecureConfigStore", "scope", ScopeAcmeCertificate, "error", err)
-		return err
+		logger.Error("Failed to save certificate", "error", err)
+		return nil, err
+	}
+	logger.Info("Saving obtained certificate", "scope", ScopeAcmeCertificate, "persistence", h.config.Persistence, "identifier", certData.Identifier)
+	if err := writer.AddCert(certData); err != nil {
+		logger.Error("Failed to save certificate", "scope", ScopeAcmeCertificate, "error", err)
+		return nil, err
 	}
 
-	logger.Info("Successfully saved certificate configuration", "scope", ScopeAcmeCertificate, "identifier", certData.Identifier)
-	return nil
+	logger.Info("Successfully saved certificate", "scope", ScopeAcmeCertificate, "identifier", certData.Identifier)
+	return &certData, nil
+}
+
+// setLeafMetadata fills the identification fields of c derived from the
+// parsed leaf certificate.
+func setLeafMetadata(c *Cert, leaf *x509.Certificate) {
+	fingerprint := sha256.Sum256(leaf.Raw)
+	spki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+
+	c.SerialNumber = fmt.Sprintf("%x", leaf.SerialNumber)
+	c.IssuerCN = leaf.Issuer.CommonName
+	c.FingerprintSHA256 = hex.EncodeToString(fingerprint[:])
+	c.SPKISHA256 = base64.StdEncoding.EncodeToString(spki[:])
+	c.KeyAlgorithm = keyAlgorithm(leaf.PublicKey)
+	c.SCTLogIDs = sctLogIDs(leaf)
+}
+
+// keyAlgorithm describes a public key by algorithm and size or curve.
+func keyAlgorithm(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
 }
@@ -0,0 +1,93 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/go-acme/lego/v4/certcrypto"
+)
+
+// ParseAccountKey reads (see ReadSecret) and parses AcmeAccountPrivateKey of
+// cfg. A key protected with AcmeAccountKeyPassphrase is decrypted first; two
+// protections are understood:
+//
+//   - an age passphrase encrypted, armored PEM key ("age -p -a key.pem"),
+//     starting with "-----BEGIN AGE ENCRYPTED FILE-----"
+//   - a legacy encrypted PEM key with a "Proc-Type: 4,ENCRYPTED" header
+//     ("openssl ec -aes256 -in key.pem")
+//
+// PKCS#8 "ENCRYPTED PRIVATE KEY" blocks are not supported.
+func ParseAccountKey(cfg *Config) (crypto.PrivateKey, error) {
+	accountKey, err := ReadSecret(cfg.AcmeAccountPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME account private key: %w", err)
+	}
+	keyPEM := []byte(accountKey)
+	defer Zeroize(keyPEM)
+
+	if strings.Contains(accountKey, "ENCRYPTED PRIVATE KEY") {
+		return nil, fmt.Errorf("ACME account private key is an encrypted PKCS#8 key, which is not supported; use a legacy encrypted PEM or age armored key")
+	}
+	if strings.Contains(accountKey, armor.Header) || isEncryptedPEM(keyPEM) {
+		passphrase, err := ReadSecret(cfg.AcmeAccountKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME account key passphrase: %w", err)
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("ACME account private key is encrypted but AcmeAccountKeyPassphrase is empty")
+		}
+		decrypted, err := decryptAccountKey(keyPEM, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt ACME account private key: %w", err)
+		}
+		defer Zeroize(decrypted)
+		keyPEM = decrypted
+	}
+
+	key, err := certcrypto.ParsePEMPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACME account private key: %w", err)
+	}
+	return key, nil
+}
+
+// decryptAccountKey returns the plain PEM of an age armored or legacy
+// encrypted PEM key.
+func decryptAccountKey(keyPEM []byte, passphrase string) ([]byte, error) {
+	if bytes.Contains(keyPEM, []byte(armor.Header)) {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		start := bytes.Index(keyPEM, []byte(armor.Header))
+		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(keyPEM[start:])), identity)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	// Legacy PEM encryption is deprecated, but it is what openssl writes for
+	// traditional EC and RSA keys.
+	der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(der)
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
+// isEncryptedPEM reports whether the first PEM block of data is a legacy
+// encrypted one.
+func isEncryptedPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && x509.IsEncryptedPEMBlock(block)
+}
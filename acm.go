@@ -0,0 +1,129 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// acmTimeout bounds one ACM import request.
+const acmTimeout = time.Minute
+
+// ACMTarget imports the renewed certificate into AWS Certificate Manager, for
+// ALB and CloudFront (which requires Region "us-east-1"). With a
+// CertificateArn the certificate is re-imported under that ARN, so listeners
+// referencing it pick up the renewal; without one every renewal creates a new
+// ACM certificate whose ARN is logged.
+type ACMTarget struct {
+	Region         string
+	CertificateArn string `toml:",omitempty"`
+
+	// Without static keys the AWS default credential chain (environment,
+	// shared config, instance role) is used, as for the route53 provider.
+	AccessKeyID     string `toml:",omitempty"`
+	SecretAccessKey string `toml:",omitempty"`
+}
+
+// acmImportRequest is the body of the ACM ImportCertificate action, called
+// directly over the AWS JSON protocol with a SigV4 signature rather than
+// through the service/acm client. Blobs are base64 encoded by encoding/json.
+type acmImportRequest struct {
+	Certificate      []byte
+	PrivateKey       []byte
+	CertificateChain []byte `json:",omitempty"`
+	CertificateArn   string `json:",omitempty"`
+}
+
+// acmDeployer imports the certificate into one ACMTarget.
+type acmDeployer struct {
+	target ACMTarget
+	logger *slog.Logger
+}
+
+func (d acmDeployer) name() string { return "acm:" + d.target.Region }
+
+func (d acmDeployer) deploy(ctx context.Context, cert *Cert) error {
+	t := d.target
+	if t.Region == "" {
+		return fmt.Errorf("ACMTarget.Region is required")
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(t.Region)}
+	if t.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(t.AccessKeyID, t.SecretAccessKey, "")))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	leafPEM, intermediatesPEM, err := cert.SplitChain()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(acmImportRequest{
+		Certificate:      leafPEM,
+		PrivateKey:       []byte(cert.PrivateKey),
+		CertificateChain: intermediatesPEM,
+		CertificateArn:   t.CertificateArn,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ACM request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, acmTimeout)
+	defer cancel()
+	endpoint := fmt.Sprintf("https://acm.%s.amazonaws.com/", t.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create ACM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "CertificateManager.ImportCertificate")
+
+	payloadHash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "acm", t.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign ACM request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ACM import failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Type != "" {
+			return fmt.Errorf("ACM import failed: %s: %s", apiErr.Type, apiErr.Message)
+		}
+		return fmt.Errorf("ACM import failed: %s", resp.Status)
+	}
+
+	var out struct{ CertificateArn string }
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return fmt.Errorf("failed to decode ACM response: %w", err)
+	}
+	if t.CertificateArn == "" {
+		d.logger.Info("Imported new ACM certificate, set ACMTarget.CertificateArn to re-import under it", "region", t.Region, "certificate_arn", out.CertificateArn)
+	}
+	return nil
+}
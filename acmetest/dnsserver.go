@@ -0,0 +1,151 @@
+// Package acmetest provides a fake dns-01 challenge provider and a local DNS
+// server for hermetic tests of applications using the acme package and of
+// new DNS provider implementations.
+package acmetest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// DNSServer is an authoritative UDP DNS server on 127.0.0.1 answering TXT
+// and SOA queries from records set by the test. Point lego at it with
+// dns01.AddRecursiveNameservers([]string{srv.Addr()}) and
+// dns01.DisableAuthoritativeNssPropagationRequirement(), or set
+// acme.PublicResolvers to []string{srv.Addr()}.
+type DNSServer struct {
+	server *dns.Server
+
+	mu      sync.Mutex
+	txt     map[string][]string // fqdn -> values
+	zones   []string
+	queries []string
+}
+
+// NewDNSServer starts a server on a free port.
+func NewDNSServer() (*DNSServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	s := &DNSServer{txt: make(map[string][]string)}
+	started := make(chan struct{})
+	s.server = &dns.Server{
+		PacketConn:        conn,
+		Handler:           dns.HandlerFunc(s.serveDNS),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go s.server.ActivateAndServe()
+	<-started
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *DNSServer) Addr() string {
+	return s.server.PacketConn.LocalAddr().String()
+}
+
+// Close stops the server.
+func (s *DNSServer) Close() error {
+	return s.server.Shutdown()
+}
+
+// AddZone makes the server answer SOA queries for zone, so lego finds it as
+// the zone of the names below it. Without zones every queried name is
+// answered as its own zone.
+func (s *DNSServer) AddZone(zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zones = append(s.zones, dns.Fqdn(zone))
+}
+
+// AddTXT adds value to the TXT records of fqdn.
+func (s *DNSServer) AddTXT(fqdn, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fqdn = canonical(fqdn)
+	s.txt[fqdn] = append(s.txt[fqdn], value)
+}
+
+// DeleteTXT removes value from the TXT records of fqdn.
+func (s *DNSServer) DeleteTXT(fqdn, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fqdn = canonical(fqdn)
+	values := s.txt[fqdn]
+	for i, v := range values {
+		if v == value {
+			s.txt[fqdn] = append(values[:i:i], values[i+1:]...)
+			break
+		}
+	}
+	if len(s.txt[fqdn]) == 0 {
+		delete(s.txt, fqdn)
+	}
+}
+
+// TXT returns the TXT records of fqdn.
+func (s *DNSServer) TXT(fqdn string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.txt[canonical(fqdn)]...)
+}
+
+// Queries returns the questions received so far as "TYPE name".
+func (s *DNSServer) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *DNSServer) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+
+	s.mu.Lock()
+	for _, q := range req.Question {
+		name := canonical(q.Name)
+		s.queries = append(s.queries, dns.TypeToString[q.Qtype]+" "+name)
+		hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: 1}
+		switch q.Qtype {
+		case dns.TypeTXT:
+			for _, v := range s.txt[name] {
+				hdr.Rrtype = dns.TypeTXT
+				resp.Answer = append(resp.Answer, &dns.TXT{Hdr: hdr, Txt: []string{v}})
+			}
+		case dns.TypeSOA:
+			if s.isZone(name) {
+				hdr.Rrtype = dns.TypeSOA
+				resp.Answer = append(resp.Answer, &dns.SOA{
+					Hdr: hdr, Ns: "ns." + name, Mbox: "hostmaster." + name,
+					Serial: 1, Refresh: 60, Retry: 60, Expire: 60, Minttl: 1,
+				})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	_ = w.WriteMsg(resp)
+}
+
+// isZone must be called with s.mu held.
+func (s *DNSServer) isZone(name string) bool {
+	if len(s.zones) == 0 {
+		return true
+	}
+	for _, z := range s.zones {
+		if strings.EqualFold(z, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func canonical(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
@@ -0,0 +1,82 @@
+package acmetest
+
+import (
+	"sync"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// FakeProvider is a lego challenge.Provider recording the TXT records the
+// dns-01 challenge asks for, and publishing them on Server when set. Set
+// PresentErr or CleanUpErr to simulate a failing DNS API.
+type FakeProvider struct {
+	Server     *DNSServer
+	PresentErr error
+	CleanUpErr error
+
+	mu       sync.Mutex
+	present  map[string]string // fqdn -> value
+	presents int
+	cleanUps int
+}
+
+// NewFakeProvider returns a provider publishing on server, which may be nil.
+func NewFakeProvider(server *DNSServer) *FakeProvider {
+	return &FakeProvider{Server: server}
+}
+
+// Present implements challenge.Provider.
+func (p *FakeProvider) Present(domain, token, keyAuth string) error {
+	if p.PresentErr != nil {
+		return p.PresentErr
+	}
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.present == nil {
+		p.present = make(map[string]string)
+	}
+	p.present[info.EffectiveFQDN] = info.Value
+	p.presents++
+	if p.Server != nil {
+		p.Server.AddTXT(info.EffectiveFQDN, info.Value)
+	}
+	return nil
+}
+
+// CleanUp implements challenge.Provider.
+func (p *FakeProvider) CleanUp(domain, token, keyAuth string) error {
+	if p.CleanUpErr != nil {
+		return p.CleanUpErr
+	}
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.present, info.EffectiveFQDN)
+	p.cleanUps++
+	if p.Server != nil {
+		p.Server.DeleteTXT(info.EffectiveFQDN, info.Value)
+	}
+	return nil
+}
+
+// Records returns the TXT records presented and not yet cleaned up, by
+// fully qualified name.
+func (p *FakeProvider) Records() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	records := make(map[string]string, len(p.present))
+	for fqdn, value := range p.present {
+		records[fqdn] = value
+	}
+	return records
+}
+
+// Calls returns how often Present and CleanUp succeeded.
+func (p *FakeProvider) Calls() (presents, cleanUps int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.presents, p.cleanUps
+}
@@ -0,0 +1,59 @@
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age/plugin"
+	"golang.org/x/term"
+)
+
+// pluginUI lets age plugins (age-plugin-yubikey, age-plugin-tpm, ...) talk
+// to the operator: messages go to stderr, PINs and confirmations are read
+// from the controlling terminal, without echo for secrets. Without a
+// terminal those requests fail, so unattended services need a PIN and touch
+// policy that does not prompt, or a cached one.
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		fmt.Fprintf(os.Stderr, "age-plugin-%s: %s\n", name, message)
+		return nil
+	},
+	RequestValue: func(name, prompt string, secret bool) (string, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return "", fmt.Errorf("age-plugin-%s requested input but no terminal is available: %w", name, err)
+		}
+		defer tty.Close()
+		fmt.Fprintf(tty, "age-plugin-%s: %s ", name, prompt)
+		if secret {
+			value, err := term.ReadPassword(int(tty.Fd()))
+			fmt.Fprintln(tty)
+			return string(value), err
+		}
+		line, err := bufio.NewReader(tty).ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return false, fmt.Errorf("age-plugin-%s requested a confirmation but no terminal is available: %w", name, err)
+		}
+		defer tty.Close()
+		if no == "" {
+			fmt.Fprintf(tty, "age-plugin-%s: %s [press enter to %s] ", name, prompt, yes)
+		} else {
+			fmt.Fprintf(tty, "age-plugin-%s: %s [%s/%s] ", name, prompt, yes, no)
+		}
+		line, err := bufio.NewReader(tty).ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		answer := strings.TrimSpace(line)
+		return no == "" || strings.EqualFold(answer, yes), nil
+	},
+	WaitTimer: func(name string) {
+		fmt.Fprintf(os.Stderr, "age-plugin-%s: waiting for the plugin, touch the hardware token if it blinks\n", name)
+	},
+}
@@ -0,0 +1,272 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ScopeAcmeAlerts is the scope of the AlertState kept between renewal jobs.
+const ScopeAcmeAlerts = "acme_alerts"
+
+const (
+	// DefaultAlertFailureThreshold is the number of consecutive failed
+	// renewals that opens an incident.
+	DefaultAlertFailureThreshold = 3
+	// DefaultAlertExpiryDays opens an incident on the first failed renewal
+	// once the stored certificate expires within that many days.
+	DefaultAlertExpiryDays = 7
+
+	pagerDutyEventsURL     = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsgenieAPIURL  = "https://api.opsgenie.com"
+	alertRequestTimeout    = 30 * time.Second
+	alertDedupKeyPrefix    = "acme-renewal-"
+	alertSourceDescription = "restinpieces-acme"
+)
+
+// Alerting opens a PagerDuty and/or Opsgenie incident when renewals keep
+// failing, and resolves it after the next successful renewal. Without a
+// PagerDutyRoutingKey or OpsgenieAPIKey it is disabled.
+type Alerting struct {
+	PagerDutyRoutingKey string `toml:",omitempty"` // Events API v2 integration key
+	OpsgenieAPIKey      string `toml:",omitempty"` // API integration key
+	// Opsgenie API base URL (default "https://api.opsgenie.com", use
+	// "https://api.eu.opsgenie.com" for EU accounts)
+	OpsgenieAPIURL   string `toml:",omitempty"`
+	FailureThreshold int    `toml:",omitempty"` // consecutive failures (default 3)
+	ExpiryDays       int    `toml:",omitempty"` // days before expiry a single failure alerts (default 7)
+}
+
+func (a Alerting) enabled() bool { return a.PagerDutyRoutingKey != "" || a.OpsgenieAPIKey != "" }
+
+// AlertState tracks the failed renewals of one certificate and whether an
+// incident is open for it.
+type AlertState struct {
+	Identifier          string
+	ConsecutiveFailures int
+	LastError           string    `toml:",omitempty"`
+	LastFailureAt       time.Time `toml:",omitempty"` // UTC
+	LastSuccessAt       time.Time `toml:",omitempty"` // UTC
+	IncidentOpen        bool
+}
+
+// LoadAlertState returns the saved AlertState, or a zero state when none was
+// saved yet. Any other failure to read the scope is returned, so a broken
+// store does not silently reset the failure count.
+func LoadAlertState(store ConfigReader) (AlertState, error) {
+	var state AlertState
+	data, format, err := store.Get(ScopeAcmeAlerts, 0)
+	if scopeEmpty(data, err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to load alert state from scope '%s': %w", ScopeAcmeAlerts, err)
+	}
+	if format != "toml" {
+		return state, fmt.Errorf("alert state in scope '%s' is in format '%s', expected 'toml'", ScopeAcmeAlerts, format)
+	}
+	if err := toml.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to unmarshal alert state: %w", err)
+	}
+	return state, nil
+}
+
+// saveAlertState saves state as the latest version of ScopeAcmeAlerts.
+func saveAlertState(store CertSaver, state AlertState) error {
+	data, err := toml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert state: %w", err)
+	}
+	description := fmt.Sprintf("Alert state of %s (%d consecutive failures, incident open: %t)", state.Identifier, state.ConsecutiveFailures, state.IncidentOpen)
+	if err := store.Save(ScopeAcmeAlerts, data, "toml", description); err != nil {
+		return fmt.Errorf("failed to save alert state to scope '%s': %w", ScopeAcmeAlerts, err)
+	}
+	return nil
+}
+
+// alert updates the AlertState with the outcome of a renewal job, opening an
+// incident once the failures cross the threshold or the stored certificate
+// is close to expiry, and resolving it on success. The state is only saved
+// when it changed. Alerting failures are logged, they never change the
+// outcome of the job.
+func (h *Renewer) alert(ctx context.Context, identifier string, renewErr error) {
+	a := h.config.Alerting
+	if !a.enabled() {
+		return
+	}
+	state, err := LoadAlertState(h.secureConfigStore)
+	if err != nil {
+		h.logger.Error("Failed to load alert state", "error", err)
+		return
+	}
+	if state.Identifier != identifier {
+		state = AlertState{Identifier: identifier}
+	}
+	now := h.clock.Now().UTC()
+
+	if renewErr == nil {
+		if state.ConsecutiveFailures == 0 && !state.IncidentOpen {
+			return
+		}
+		if state.IncidentOpen {
+			if err := h.sendAlert(ctx, a, identifier, "", false); err != nil {
+				h.logger.Error("Failed to resolve renewal incident", "error", err)
+			} else {
+				h.logger.Info("Resolved renewal incident", "identifier", identifier)
+				state.IncidentOpen = false
+			}
+		}
+		state.ConsecutiveFailures = 0
+		state.LastSuccessAt = now
+	} else {
+		state.ConsecutiveFailures++
+		state.LastError = renewErr.Error()
+		state.LastFailureAt = now
+		if reason := h.alertReason(a, state, identifier, now); reason != "" && !state.IncidentOpen {
+			summary := fmt.Sprintf("Certificate renewal for %s failing: %s", identifier, reason)
+			if err := h.sendAlert(ctx, a, identifier, summary, true); err != nil {
+				h.logger.Error("Failed to open renewal incident", "error", err)
+			} else {
+				h.logger.Warn("Opened renewal incident", "identifier", identifier, "reason", reason)
+				state.IncidentOpen = true
+			}
+		}
+	}
+
+	if err := saveAlertState(h.secureConfigStore, state); err != nil {
+		h.logger.Error("Failed to save alert state", "error", err)
+	}
+}
+
+// alertReason returns why the failing renewal described by state deserves
+// an incident, or "" when it does not yet.
+func (h *Renewer) alertReason(a Alerting, state AlertState, identifier string, now time.Time) string {
+	threshold := a.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultAlertFailureThreshold
+	}
+	if state.ConsecutiveFailures >= threshold {
+		return fmt.Sprintf("%d consecutive failures, last: %s", state.ConsecutiveFailures, state.LastError)
+	}
+
+	days := a.ExpiryDays
+	if days <= 0 {
+		days = DefaultAlertExpiryDays
+	}
+	r, ok := h.certReader()
+	if !ok {
+		return ""
+	}
+	stored, err := r.ByIdentifier(identifier)
+	if err != nil || stored == nil {
+		return ""
+	}
+	if stored.ExpiresAt.Sub(now) < time.Duration(days)*24*time.Hour {
+		return fmt.Sprintf("stored certificate expires %s, last error: %s", stored.ExpiresAt.Format(time.RFC3339), state.LastError)
+	}
+	return ""
+}
+
+// sendAlert triggers (with summary) or resolves the incident of identifier
+// on every configured service. The dedup key is derived from identifier, so
+// repeating either action is harmless.
+func (h *Renewer) sendAlert(ctx context.Context, a Alerting, identifier, summary string, trigger bool) error {
+	ctx, cancel := context.WithTimeout(ctx, alertRequestTimeout)
+	defer cancel()
+
+	key := alertDedupKeyPrefix + identifier
+	var errs []error
+	if a.PagerDutyRoutingKey != "" {
+		if err := sendPagerDutyEvent(ctx, a.PagerDutyRoutingKey, key, summary, trigger); err != nil {
+			errs = append(errs, fmt.Errorf("pagerduty: %w", err))
+		}
+	}
+	if a.OpsgenieAPIKey != "" {
+		if err := sendOpsgenieAlert(ctx, a, key, summary, trigger); err != nil {
+			errs = append(errs, fmt.Errorf("opsgenie: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendPagerDutyEvent sends a trigger or resolve event to the PagerDuty
+// Events API v2.
+func sendPagerDutyEvent(ctx context.Context, routingKey, dedupKey, summary string, trigger bool) error {
+	event := map[string]any{
+		"routing_key":  routingKey,
+		"dedup_key":    dedupKey,
+		"event_action": "resolve",
+	}
+	if trigger {
+		event["event_action"] = "trigger"
+		event["payload"] = map[string]any{
+			"summary":  summary,
+			"source":   alertSourceDescription,
+			"severity": "critical",
+		}
+	}
+	return postAlertJSON(ctx, pagerDutyEventsURL, nil, event)
+}
+
+// sendOpsgenieAlert creates the alert with alias dedupKey, or closes it.
+func sendOpsgenieAlert(ctx context.Context, a Alerting, dedupKey, summary string, trigger bool) error {
+	base := strings.TrimRight(a.OpsgenieAPIURL, "/")
+	if base == "" {
+		base = defaultOpsgenieAPIURL
+	}
+	header := http.Header{"Authorization": {"GenieKey " + a.OpsgenieAPIKey}}
+	if trigger {
+		return postAlertJSON(ctx, base+"/v2/alerts", header, map[string]any{
+			"message":  truncate(summary, 130),
+			"alias":    dedupKey,
+			"source":   alertSourceDescription,
+			"priority": "P1",
+		})
+	}
+	endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", base, url.PathEscape(dedupKey))
+	return postAlertJSON(ctx, endpoint, header, map[string]any{"source": alertSourceDescription})
+}
+
+// postAlertJSON POSTs body as JSON to endpoint with the extra header.
+func postAlertJSON(ctx context.Context, endpoint string, header http.Header, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,76 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// lifetimeTolerance is how much the validity period of a new certificate may
+// differ from the previous one before IssuanceChanges reports it. CAs
+// backdate NotBefore by varying amounts, so small differences are normal.
+const lifetimeTolerance = 24 * time.Hour
+
+// IssuanceChanges compares a newly issued certificate with the one it
+// replaces and describes CA-side changes operators should know about: a
+// different validity period (e.g. a new issuance profile), a different
+// issuer or different intermediates (e.g. an intermediate rotation). It
+// returns nil when previous is nil, self-signed or its chain does not parse.
+func IssuanceChanges(previous, issued *Cert) []string {
+	if previous == nil || previous.SelfSigned {
+		return nil
+	}
+	oldChain, err := previous.ParseChain()
+	if err != nil || len(oldChain) == 0 {
+		return nil
+	}
+	newChain, err := issued.ParseChain()
+	if err != nil || len(newChain) == 0 {
+		return nil
+	}
+
+	var changes []string
+	oldLifetime := oldChain[0].NotAfter.Sub(oldChain[0].NotBefore)
+	newLifetime := newChain[0].NotAfter.Sub(newChain[0].NotBefore)
+	if diff := newLifetime - oldLifetime; diff > lifetimeTolerance || diff < -lifetimeTolerance {
+		changes = append(changes, fmt.Sprintf("validity period changed from %s to %s", formatDays(oldLifetime), formatDays(newLifetime)))
+	}
+	if o, n := oldChain[0].Issuer.String(), newChain[0].Issuer.String(); o != n {
+		changes = append(changes, fmt.Sprintf("issuer changed from '%s' to '%s'", o, n))
+	}
+	if o, n := intermediateFingerprints(oldChain), intermediateFingerprints(newChain); !slices.Equal(o, n) {
+		changes = append(changes, fmt.Sprintf("intermediate chain changed from %v to %v", intermediateNames(oldChain), intermediateNames(newChain)))
+	}
+	if o, n := keyAlgorithm(oldChain[0].PublicKey), keyAlgorithm(newChain[0].PublicKey); o != n {
+		changes = append(changes, fmt.Sprintf("key algorithm changed from %s to %s", o, n))
+	}
+	return changes
+}
+
+// intermediateFingerprints returns the hex SHA-256 of every certificate
+// after the leaf.
+func intermediateFingerprints(chain []*x509.Certificate) []string {
+	fps := make([]string, 0, len(chain)-1)
+	for _, c := range chain[1:] {
+		sum := sha256.Sum256(c.Raw)
+		fps = append(fps, hex.EncodeToString(sum[:]))
+	}
+	return fps
+}
+
+// intermediateNames returns the subject common name of every certificate
+// after the leaf.
+func intermediateNames(chain []*x509.Certificate) []string {
+	names := make([]string, 0, len(chain)-1)
+	for _, c := range chain[1:] {
+		names = append(names, c.Subject.CommonName)
+	}
+	return names
+}
+
+func formatDays(d time.Duration) string {
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
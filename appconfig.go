@@ -0,0 +1,61 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// UpdateAppConfig sets Server.CertData and Server.KeyData of the latest
+// restinpieces application config to cert and saves the result as a new
+// version of config.ScopeApplication. The restinpieces server builds its TLS
+// config from these fields once at startup, so it serves the new certificate
+// after its next restart; a SIGHUP reload only warns that a restart is
+// required.
+func UpdateAppConfig(store config.SecureStore, cert *Cert) error {
+	data, format, err := store.Get(config.ScopeApplication, 0)
+	if err != nil {
+		return fmt.Errorf("failed to load application config from scope '%s': %w", config.ScopeApplication, err)
+	}
+	defer Zeroize(data)
+	if len(data) == 0 {
+		return fmt.Errorf("no application config found in scope '%s'", config.ScopeApplication)
+	}
+	if format != "toml" {
+		return fmt.Errorf("application config in scope '%s' is in format '%s', expected 'toml'", config.ScopeApplication, format)
+	}
+
+	var appCfg config.Config
+	if err := toml.Unmarshal(data, &appCfg); err != nil {
+		return fmt.Errorf("failed to unmarshal application config: %w", err)
+	}
+	if appCfg.Server.CertData == cert.CertificateChain && appCfg.Server.KeyData == cert.PrivateKey {
+		return nil
+	}
+	appCfg.Server.CertData = cert.CertificateChain
+	appCfg.Server.KeyData = cert.PrivateKey
+
+	updated, err := toml.Marshal(appCfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal application config: %w", err)
+	}
+	defer Zeroize(updated)
+	description := fmt.Sprintf("Updated TLS cert/key data (identifier: %s, expires %s)", cert.Identifier, cert.ExpiresAt.Format("2006-01-02"))
+	if err := store.Save(config.ScopeApplication, updated, "toml", description); err != nil {
+		return fmt.Errorf("failed to save application config to scope '%s': %w", config.ScopeApplication, err)
+	}
+	return nil
+}
+
+// appConfigDeployer copies renewed certificates into the application config.
+type appConfigDeployer struct {
+	store config.SecureStore
+}
+
+func (d appConfigDeployer) name() string { return "app_config" }
+
+func (d appConfigDeployer) deploy(ctx context.Context, cert *Cert) error {
+	return UpdateAppConfig(d.store, cert)
+}
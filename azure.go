@@ -0,0 +1,155 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// azureTimeout bounds the token request and the import together.
+	azureTimeout = time.Minute
+
+	azureKeyVaultAPIVersion = "7.4"
+	azureKeyVaultResource   = "https://vault.azure.net"
+	azureIMDSTokenURL       = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// AzureKeyVaultTarget imports the renewed certificate into an Azure Key
+// Vault, e.g. for Application Gateway listeners referencing it. Each import
+// adds a new version of CertificateName; consumers of the versionless
+// secret ID follow it automatically.
+type AzureKeyVaultTarget struct {
+	VaultURL        string // e.g. "https://myvault.vault.azure.net"
+	CertificateName string
+
+	// Service principal credentials. Without them the managed identity of
+	// the host is used.
+	TenantID     string `toml:",omitempty"`
+	ClientID     string `toml:",omitempty"`
+	ClientSecret string `toml:",omitempty"`
+}
+
+// azureDeployer imports the certificate into one AzureKeyVaultTarget.
+type azureDeployer struct {
+	target AzureKeyVaultTarget
+}
+
+func (d azureDeployer) name() string { return "azure_key_vault:" + d.target.CertificateName }
+
+func (d azureDeployer) deploy(ctx context.Context, cert *Cert) error {
+	t := d.target
+	if t.VaultURL == "" || t.CertificateName == "" {
+		return fmt.Errorf("AzureKeyVaultTarget.VaultURL and CertificateName are required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, azureTimeout)
+	defer cancel()
+
+	token, err := azureToken(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	// Key Vault accepts a single PEM document with the key and the chain.
+	body, err := json.Marshal(map[string]any{
+		"value": string(cert.CombinedPEM()),
+		"policy": map[string]any{
+			"secret_props": map[string]string{"contentType": "application/x-pem-file"},
+		},
+		"tags": map[string]string{"identifier": cert.Identifier},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Key Vault request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/certificates/%s/import?api-version=%s",
+		strings.TrimSuffix(t.VaultURL, "/"), url.PathEscape(t.CertificateName), azureKeyVaultAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Key Vault request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if _, err := doAzure(req); err != nil {
+		return fmt.Errorf("Key Vault import failed: %w", err)
+	}
+	return nil
+}
+
+// azureToken obtains a Key Vault access token, with the client credentials
+// of t or from the instance metadata service.
+func azureToken(ctx context.Context, t AzureKeyVaultTarget) (string, error) {
+	var req *http.Request
+	var err error
+	if t.ClientID != "" {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {t.ClientID},
+			"client_secret": {t.ClientSecret},
+			"scope":         {azureKeyVaultResource + "/.default"},
+		}
+		tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(t.TenantID))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureKeyVaultResource}}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSTokenURL+"?"+query.Encode(), nil)
+		if err == nil {
+			req.Header.Set("Metadata", "true")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create Azure token request: %w", err)
+	}
+
+	body, err := doAzure(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain Azure access token: %w", err)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil || out.AccessToken == "" {
+		return "", fmt.Errorf("failed to obtain Azure access token: unexpected response")
+	}
+	return out.AccessToken, nil
+}
+
+// doAzure sends req and returns the response body, turning non-2xx
+// responses into errors with the service's message.
+func doAzure(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil {
+			if apiErr.Error.Code != "" {
+				return nil, fmt.Errorf("%s: %s: %s", resp.Status, apiErr.Error.Code, apiErr.Error.Message)
+			}
+			if apiErr.Description != "" {
+				return nil, fmt.Errorf("%s: %s", resp.Status, apiErr.Description)
+			}
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS12 encodes the certificate chain and private key as a passphrase
+// protected PKCS#12 (.p12/.pfx) bundle, using AES-256 and PBKDF2 as
+// supported by current OpenSSL, Java and Windows.
+func (c *Cert) PKCS12(passphrase string) ([]byte, error) {
+	chain, key, err := c.parseBundle()
+	if err != nil {
+		return nil, err
+	}
+	data, err := pkcs12.Modern.Encode(key, chain[0], chain[1:], passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#12 bundle: %w", err)
+	}
+	return data, nil
+}
+
+// JKS encodes the certificate chain and private key as a Java KeyStore with
+// a single private key entry under alias. The store and the entry share the
+// passphrase, as most Java servers expect.
+func (c *Cert) JKS(passphrase, alias string) ([]byte, error) {
+	chain, key, err := c.parseBundle()
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key as PKCS#8: %w", err)
+	}
+
+	entry := keystore.PrivateKeyEntry{
+		CreationTime: time.Now(),
+		PrivateKey:   keyDER,
+	}
+	for _, cert := range chain {
+		entry.CertificateChain = append(entry.CertificateChain, keystore.Certificate{Type: "X509", Content: cert.Raw})
+	}
+
+	ks := keystore.New()
+	if err := ks.SetPrivateKeyEntry(alias, entry, []byte(passphrase)); err != nil {
+		return nil, fmt.Errorf("failed to add JKS entry: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(passphrase)); err != nil {
+		return nil, fmt.Errorf("failed to encode JKS keystore: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Cert) parseBundle() ([]*x509.Certificate, any, error) {
+	chain, err := c.ParseChain()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := certcrypto.ParsePEMPrivateKey([]byte(c.PrivateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return chain, key, nil
+}
@@ -0,0 +1,284 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ParseChain decodes every CERTIFICATE block of the PEM chain, in the order
+// they appear. The leaf is expected first, as returned by the CA.
+func (c *Cert) ParseChain() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(c.CertificateChain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d of chain: %w", len(certs), err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found in chain")
+	}
+	return certs, nil
+}
+
+// ParseObtainedChain parses the PEM chain obtained from a CA and returns it
+// leaf first, each certificate followed by the one that issued it. The leaf
+// is the non-CA certificate covering every domain, so a chain listing the
+// intermediates before the leaf or in reverse order is accepted; duplicates
+// are dropped. Non-certificate blocks, data that is not PEM, a missing or
+// ambiguous leaf and certificates not part of the leaf's chain are errors.
+func ParseObtainedChain(chainPEM []byte, domains []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	seen := make(map[string]bool)
+	rest := chainPEM
+	for {
+		block, next := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		rest = next
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q after certificate %d of chain", block.Type, len(certs))
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d of chain: %w", len(certs), err)
+		}
+		if !seen[string(cert.Raw)] {
+			seen[string(cert.Raw)] = true
+			certs = append(certs, cert)
+		}
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, fmt.Errorf("malformed PEM data after certificate %d of chain", len(certs))
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found in chain")
+	}
+
+	var leaf *x509.Certificate
+	var others []*x509.Certificate
+	for _, cert := range certs {
+		if cert.IsCA || !coversDomains(cert, domains) {
+			others = append(others, cert)
+			continue
+		}
+		if leaf != nil {
+			return nil, fmt.Errorf("chain has more than one leaf certificate covering the domains (serials %s and %s)", leaf.SerialNumber.Text(16), cert.SerialNumber.Text(16))
+		}
+		leaf = cert
+	}
+	if leaf == nil {
+		return nil, fmt.Errorf("chain has no non-CA certificate covering %s", strings.Join(domains, ", "))
+	}
+
+	ordered := []*x509.Certificate{leaf}
+	for len(others) > 0 {
+		last := ordered[len(ordered)-1]
+		i := slices.IndexFunc(others, func(c *x509.Certificate) bool {
+			return bytes.Equal(last.RawIssuer, c.RawSubject) && last.CheckSignatureFrom(c) == nil
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("certificate %q of chain is not part of the chain of the leaf", others[0].Subject.CommonName)
+		}
+		ordered = append(ordered, others[i])
+		others = slices.Delete(others, i, i+1)
+	}
+	return ordered, nil
+}
+
+// EncodeChain returns certs as a PEM chain.
+func EncodeChain(certs []*x509.Certificate) []byte {
+	var chainPEM []byte
+	for _, cert := range certs {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return chainPEM
+}
+
+// coversDomains reports whether cert is valid for every domain.
+func coversDomains(cert *x509.Certificate, domains []string) bool {
+	for _, domain := range domains {
+		if cert.VerifyHostname(domain) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitChain returns the PEM encoded leaf and the PEM encoded intermediates
+// (everything after the leaf) of the stored chain.
+func (c *Cert) SplitChain() (leafPEM, intermediatesPEM []byte, err error) {
+	chain, err := c.ParseChain()
+	if err != nil {
+		return nil, nil, err
+	}
+	leafPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0].Raw})
+	for _, cert := range chain[1:] {
+		intermediatesPEM = append(intermediatesPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return leafPEM, intermediatesPEM, nil
+}
+
+// CombinedPEM returns the private key followed by the full chain in a single
+// PEM document, the layout HAProxy and some load balancers require.
+func (c *Cert) CombinedPEM() []byte {
+	combined := []byte(strings.TrimRight(c.PrivateKey, "\n") + "\n")
+	return append(combined, c.CertificateChain...)
+}
+
+// Verify builds the chains from the leaf to one of roots at time now, using
+// the stored intermediates, and requires the leaf to be valid for TLS server
+// authentication. A nil roots uses the system root pool.
+func (c *Cert) Verify(roots *x509.CertPool, now time.Time) ([][]*x509.Certificate, error) {
+	chain, err := c.ParseChain()
+	if err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chain does not verify: %w", err)
+	}
+	return chains, nil
+}
+
+// RootPool returns the system root pool plus the PEM certificates in
+// extraPEM, which may be a "file:/path" reference (see ReadSecret).
+func RootPool(extraPEM string) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if extraPEM == "" {
+		return roots, nil
+	}
+	pemData, err := ReadSecret(extraPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !roots.AppendCertsFromPEM([]byte(pemData)) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in trusted roots")
+	}
+	return roots, nil
+}
+
+// KeyMatchesLeaf returns an error unless the private key belongs to the leaf
+// certificate.
+func (c *Cert) KeyMatchesLeaf() error {
+	if _, err := tls.X509KeyPair([]byte(c.CertificateChain), []byte(c.PrivateKey)); err != nil {
+		return fmt.Errorf("private key does not match the leaf certificate: %w", err)
+	}
+	return nil
+}
+
+// leafFingerprint returns FingerprintSHA256, computing it from the chain for
+// certificates stored before the field existed. It is empty if the chain
+// does not parse.
+func (c *Cert) leafFingerprint() string {
+	if c.FingerprintSHA256 != "" {
+		return c.FingerprintSHA256
+	}
+	chain, err := c.ParseChain()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(chain[0].Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxClockSkew is how far in the future a leaf's NotBefore may lie before
+// Validate rejects it.
+const maxClockSkew = time.Hour
+
+// Validate performs the local checks a TLS client would, without needing the
+// CA's root: the chain parses and each certificate is signed by the next, the
+// key matches the leaf, the leaf covers every domain in Domains, and it is
+// valid at now (allowing maxClockSkew for NotBefore).
+func (c *Cert) Validate(now time.Time) error {
+	chain, err := c.ParseChain()
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("certificate %d of the chain is not signed by the next: %w", i, err)
+		}
+	}
+	if err := c.KeyMatchesLeaf(); err != nil {
+		return err
+	}
+
+	leaf := chain[0]
+	for _, domain := range c.Domains {
+		if err := leaf.VerifyHostname(domain); err != nil {
+			return fmt.Errorf("leaf certificate does not cover %s", domain)
+		}
+	}
+	if leaf.NotBefore.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("leaf certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if !leaf.NotAfter.After(now) {
+		return fmt.Errorf("leaf certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// NewCert builds a Cert from a PEM chain (leaf first) and its PEM private
+// key, deriving validity and identification fields from the leaf. An empty
+// identifier defaults to the first domain; nil domains default to the leaf
+// SANs.
+func NewCert(identifier string, domains []string, chainPEM, keyPEM []byte) (*Cert, error) {
+	c := &Cert{
+		CertificateChain: string(chainPEM),
+		PrivateKey:       string(keyPEM),
+	}
+	chain, err := c.ParseChain()
+	if err != nil {
+		return nil, err
+	}
+	leaf := chain[0]
+
+	if len(domains) == 0 {
+		domains = leaf.DNSNames
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("leaf certificate has no DNS names and no domains were given")
+	}
+	if identifier == "" {
+		identifier = domains[0]
+	}
+
+	c.Identifier = identifier
+	c.Domains = domains
+	c.IssuedAt = leaf.NotBefore.UTC()
+	c.ExpiresAt = leaf.NotAfter.UTC()
+	setLeafMetadata(c, leaf)
+	return c, nil
+}
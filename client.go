@@ -0,0 +1,113 @@
+package acme
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+)
+
+// AcmeClient is the part of an ACME client the handler and Revoke use. The
+// default implementation, from NewLegoClient, is backed by lego; tests can
+// substitute a mock with CertRenewalHandler.SetClientFactory.
+type AcmeClient interface {
+	// SetDNS01Provider makes Obtain solve dns-01 challenges with p.
+	SetDNS01Provider(p challenge.Provider, opts ...dns01.ChallengeOption) error
+	// Register creates the account of the key, or retrieves it if it
+	// exists, and returns its URI.
+	Register() (accountURI string, err error)
+	// Obtain orders, validates and downloads a certificate.
+	Obtain(request certificate.ObtainRequest) (*certificate.Resource, error)
+	// Revoke revokes the leaf of certPEM with an RFC 5280 reason code,
+	// looking up the existing account first; it never creates one.
+	Revoke(certPEM []byte, reason uint) error
+	// RenewalInfo returns the ACME Renewal Information (RFC 9773) of leaf.
+	RenewalInfo(leaf *x509.Certificate) (*certificate.RenewalInfoResponse, error)
+	// Close wipes the account key held by the client.
+	Close()
+}
+
+// ClientFactory creates the AcmeClient for cfg.
+type ClientFactory func(cfg *Config) (AcmeClient, error)
+
+// SetClientFactory makes the handler create its ACME client with f instead
+// of NewLegoClient.
+func (h *Renewer) SetClientFactory(f ClientFactory) {
+	h.newClient = f
+}
+
+// defaultClientFactory returns the factory of a new handler: NewDevCAClient
+// on store in IssuanceModeDev, NewLegoClient otherwise.
+func defaultClientFactory(store config.SecureStore) ClientFactory {
+	return func(cfg *Config) (AcmeClient, error) {
+		if cfg.IssuanceMode == IssuanceModeDev {
+			return NewDevCAClient(store)
+		}
+		return NewLegoClient(cfg)
+	}
+}
+
+// NewLegoClient parses the ACME account key of cfg and returns a lego backed
+// AcmeClient for the configured CA directory.
+func NewLegoClient(cfg *Config) (AcmeClient, error) {
+	legoClient, acmeUser, err := newLegoClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &legoAcmeClient{client: legoClient, user: acmeUser}, nil
+}
+
+// legoAcmeClient is the AcmeClient of NewLegoClient.
+type legoAcmeClient struct {
+	client *lego.Client
+	user   *AcmeUser
+}
+
+// SetDNS01Provider implements AcmeClient.
+func (c *legoAcmeClient) SetDNS01Provider(p challenge.Provider, opts ...dns01.ChallengeOption) error {
+	return c.client.Challenge.SetDNS01Provider(p, opts...)
+}
+
+// Register implements AcmeClient.
+func (c *legoAcmeClient) Register() (string, error) {
+	reg, err := c.client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if err != nil {
+		return "", err
+	}
+	c.user.Registration = reg
+	return reg.URI, nil
+}
+
+// Obtain implements AcmeClient.
+func (c *legoAcmeClient) Obtain(request certificate.ObtainRequest) (*certificate.Resource, error) {
+	return c.client.Certificate.Obtain(request)
+}
+
+// Revoke implements AcmeClient.
+func (c *legoAcmeClient) Revoke(certPEM []byte, reason uint) error {
+	// Revocation requests are signed with the account KID, so the existing
+	// account has to be looked up. Unlike Register this never creates one.
+	if c.user.Registration == nil {
+		reg, err := c.client.Registration.ResolveAccountByKey()
+		if err != nil {
+			return fmt.Errorf("failed to resolve ACME account for %s: %w", c.user.Email, err)
+		}
+		c.user.Registration = reg
+	}
+	return c.client.Certificate.RevokeWithReason(certPEM, &reason)
+}
+
+// RenewalInfo implements AcmeClient.
+func (c *legoAcmeClient) RenewalInfo(leaf *x509.Certificate) (*certificate.RenewalInfoResponse, error) {
+	return c.client.Certificate.GetRenewalInfo(certificate.RenewalInfoRequest{Cert: leaf})
+}
+
+// Close implements AcmeClient.
+func (c *legoAcmeClient) Close() {
+	zeroizeKey(c.user.PrivateKey)
+}
@@ -0,0 +1,58 @@
+package acme
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the handlers the time used for renewal and expiry decisions,
+// certificate validation and the timestamps of events, alerts and
+// deployment reports. Durations of the ACME order and of the job are still
+// measured with the monotonic wall clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the running system, the default.
+type SystemClock struct{}
+
+// Now implements Clock.
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// FixedClock is a Clock that only moves when told to, for deterministic
+// tests of threshold logic.
+type FixedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFixedClock returns a FixedClock standing at now.
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+// Now implements Clock.
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *FixedClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *FixedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock makes the handler read the time from c instead of the system.
+func (h *Renewer) SetClock(c Clock) {
+	h.clock = c
+}
@@ -0,0 +1,134 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cloudflareAPIURL is the base of the Cloudflare v4 API.
+var cloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflarePreflightTimeout bounds CheckCloudflareToken.
+const cloudflarePreflightTimeout = 30 * time.Second
+
+// cloudflareDNSEdit is the zone permission needed to create challenge records.
+const cloudflareDNSEdit = "#dns_records:edit"
+
+// CheckCloudflareToken verifies, before an ACME order is started, that the
+// Cloudflare API token is active and can see the zone of every domain, and,
+// where Cloudflare reports the permissions of the token on a zone, that it
+// may edit DNS records there. Without this check a wrong token scope only
+// shows up as a propagation timeout minutes into the order. Creating a
+// record, as `acme dns test` does, remains the definitive check.
+func CheckCloudflareToken(ctx context.Context, token string, domains []string) error {
+	ctx, cancel := context.WithTimeout(ctx, cloudflarePreflightTimeout)
+	defer cancel()
+
+	var verify struct {
+		Status string `json:"status"`
+	}
+	if err := cloudflareGet(ctx, token, "/user/tokens/verify", &verify); err != nil {
+		return fmt.Errorf("cloudflare API token verification failed: %w", err)
+	}
+	if verify.Status != "active" {
+		return fmt.Errorf("cloudflare API token is %s, not active", verify.Status)
+	}
+
+	checked := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(domain, "*.")
+		zone, err := cloudflareZoneFor(ctx, token, domain)
+		if err != nil {
+			return err
+		}
+		if checked[zone.Name] {
+			continue
+		}
+		checked[zone.Name] = true
+		if len(zone.Permissions) > 0 && !slices.Contains(zone.Permissions, cloudflareDNSEdit) {
+			return fmt.Errorf("cloudflare API token cannot edit DNS records of zone %s (needed for %s); grant it Zone:DNS:Edit", zone.Name, domain)
+		}
+	}
+	return nil
+}
+
+type cloudflareZone struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// cloudflareZoneFor returns the zone of domain visible to the token, trying
+// domain and then each parent name.
+func cloudflareZoneFor(ctx context.Context, token, domain string) (*cloudflareZone, error) {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+		var zones []cloudflareZone
+		if err := cloudflareGet(ctx, token, "/zones?name="+url.QueryEscape(name), &zones); err != nil {
+			return nil, fmt.Errorf("failed to look up cloudflare zone %s: %w", name, err)
+		}
+		if len(zones) > 0 {
+			return &zones[0], nil
+		}
+	}
+	return nil, fmt.Errorf("cloudflare API token has no access to a zone of %s; grant it Zone:Zone:Read and Zone:DNS:Edit for that zone", domain)
+}
+
+// cloudflareGet calls the API and decodes the "result" of a successful
+// response into out.
+func cloudflareGet(ctx context.Context, token, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareAPIURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	var envelope struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("unexpected response (%s): %s", resp.Status, truncate(string(body), 512))
+	}
+	if !envelope.Success {
+		msgs := make([]string, 0, len(envelope.Errors))
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.Join(msgs, "; "))
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// preflightCloudflare runs CheckCloudflareToken for the active Cloudflare
+// provider of cfg.
+func (h *Renewer) preflightCloudflare(ctx context.Context, cfg *Config) error {
+	token, err := ReadSecret(cfg.DNSProviders[DNSProviderCloudflare].Credential("APIToken"))
+	if err != nil {
+		return fmt.Errorf("failed to read cloudflare credentials: %w", err)
+	}
+	if err := CheckCloudflareToken(ctx, token, cfg.Domains); err != nil {
+		h.logger.Error("Cloudflare token preflight failed, not starting the order", "error", err)
+		return err
+	}
+	h.logger.Debug("Cloudflare token preflight passed", "domains", cfg.Domains)
+	return nil
+}
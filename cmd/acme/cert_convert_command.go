@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+// handleCertConvertCommand writes the stored certificate and key as a
+// passphrase protected PKCS#12 or JKS bundle.
+func handleCertConvertCommand(certStore *acme.SecureCertStore, identifier string, generation int, format, out, passphraseFile, alias string) error {
+	passphrase, err := readPassphrase(passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	c, err := loadCert(certStore, identifier, generation)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch format {
+	case "p12", "pkcs12", "pfx":
+		data, err = c.PKCS12(passphrase)
+	case "jks":
+		if alias == "" {
+			alias = c.Identifier
+		}
+		data, err = c.JKS(passphrase, alias)
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("unknown bundle format '%s' (want p12 or jks)", format))
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	// WriteFile keeps the mode of an existing file, so enforce it.
+	if err := os.Chmod(out, 0600); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", out, err)
+	}
+	fmt.Printf("Wrote %s\n", out)
+	return nil
+}
+
+// readPassphrase reads the first line of path, or of stdin for "-". The
+// passphrase is never taken from the command line, where other users could
+// read it from the process list.
+func readPassphrase(path string) (string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open passphrase file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase is empty")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+func handleCertExportCommand(certStore *acme.SecureCertStore, identifier string, generation int, dir string) error {
+	c, err := loadCert(certStore, identifier, generation)
+	if err != nil {
+		return err
+	}
+
+	leafPEM, intermediatesPEM, err := c.SplitChain()
+	if err != nil {
+		return fmt.Errorf("failed to split stored certificate chain: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create export directory '%s': %w", dir, err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"cert.pem", leafPEM},
+		{"chain.pem", intermediatesPEM},
+		{"fullchain.pem", []byte(c.CertificateChain)},
+		{"privkey.pem", []byte(c.PrivateKey)},
+		{"combined.pem", c.CombinedPEM()},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, f.data, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		// WriteFile keeps the mode of an existing file, so enforce it.
+		if err := os.Chmod(path, 0600); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+func handleCertImportCommand(certStore *acme.SecureCertStore, identifier, certPath, keyPath string) error {
+	chainPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate file '%s': %w", certPath, err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read key file '%s': %w", keyPath, err)
+	}
+	defer acme.Zeroize(keyPEM)
+
+	// Rejects a key that does not belong to the leaf.
+	if _, err := tls.X509KeyPair(chainPEM, keyPEM); err != nil {
+		return fmt.Errorf("certificate and key do not form a valid pair: %w", err)
+	}
+
+	c, err := acme.NewCert(identifier, nil, chainPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to build certificate from '%s': %w", certPath, err)
+	}
+
+	if err := certStore.AddCert(*c); err != nil {
+		return withExitCode(exitStorage, err)
+	}
+	fmt.Printf("Imported certificate '%s' (expires %s) into scope %s\n", c.Identifier, c.ExpiresAt.Format("2006-01-02"), certStore.Scope())
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+type certListEntry struct {
+	Generation    int        `json:"generation"`
+	Identifier    string     `json:"identifier"`
+	Domains       []string   `json:"domains"`
+	IssuedAt      time.Time  `json:"issued_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	DaysRemaining int        `json:"days_remaining"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+func handleCertListCommand(certStore *acme.SecureCertStore, output string) error {
+	certs, err := certStore.History()
+	if err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("failed to list certificates: %w", err))
+	}
+
+	now := time.Now()
+	if output == outputJSON {
+		entries := make([]certListEntry, 0, len(certs))
+		for gen, c := range certs {
+			entry := certListEntry{
+				Generation:    gen,
+				Identifier:    c.Identifier,
+				Domains:       c.Domains,
+				IssuedAt:      c.IssuedAt,
+				ExpiresAt:     c.ExpiresAt,
+				DaysRemaining: daysRemaining(c.ExpiresAt, now),
+			}
+			if !c.RevokedAt.IsZero() {
+				entry.RevokedAt = &certs[gen].RevokedAt
+			}
+			entries = append(entries, entry)
+		}
+		return writeJSON(entries)
+	}
+
+	if len(certs) == 0 {
+		fmt.Printf("No certificates found in scope: %s\n", certStore.Scope())
+		return nil
+	}
+
+	fmt.Println("Gen  Identifier            Issued At             Expires At            Days  Domains")
+	fmt.Println("---  --------------------  --------------------  --------------------  ----  -------")
+
+	for gen, c := range certs {
+		fmt.Printf("%3d  %-20s  %-20s  %-20s  %4d  %s\n",
+			gen,
+			c.Identifier,
+			c.IssuedAt.Format(time.RFC3339),
+			c.ExpiresAt.Format(time.RFC3339),
+			daysRemaining(c.ExpiresAt, now),
+			strings.Join(c.Domains, ","),
+		)
+	}
+	return nil
+}
+
+// daysRemaining returns the whole days left until expiry, negative once
+// expired.
+func daysRemaining(expiresAt, now time.Time) int {
+	return int(expiresAt.Sub(now).Hours() / 24)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+	legoacme "github.com/go-acme/lego/v4/acme"
+)
+
+// revocationReasons maps the accepted -reason names to RFC 5280 codes.
+var revocationReasons = map[string]uint{
+	"unspecified":          legoacme.CRLReasonUnspecified,
+	"keyCompromise":        legoacme.CRLReasonKeyCompromise,
+	"affiliationChanged":   legoacme.CRLReasonAffiliationChanged,
+	"superseded":           legoacme.CRLReasonSuperseded,
+	"cessationOfOperation": legoacme.CRLReasonCessationOfOperation,
+}
+
+func parseRevocationReason(s string) (uint, error) {
+	if code, ok := revocationReasons[s]; ok {
+		return code, nil
+	}
+	code, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, withExitCode(exitUsage, fmt.Errorf("unknown revocation reason '%s' (use unspecified, keyCompromise, affiliationChanged, superseded, cessationOfOperation or a numeric code)", s))
+	}
+	return uint(code), nil
+}
+
+func handleCertRevokeCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, identifier string, generation int, reasonName string, logger *slog.Logger) error {
+	reason, err := parseRevocationReason(reasonName)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadAcmeConfig(secureStore)
+	if err != nil {
+		return err
+	}
+
+	c, err := loadCert(certStore, identifier, generation)
+	if err != nil {
+		return err
+	}
+	if !c.RevokedAt.IsZero() {
+		return fmt.Errorf("certificate '%s' (serial %s) was already revoked at %s", c.Identifier, c.SerialNumber, c.RevokedAt)
+	}
+
+	renewer, err := acme.NewRenewer(cfg, secureStore, logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), renewTimeout)
+	defer cancel()
+	if err := renewer.RevokeCert(ctx, c, reason); err != nil {
+		return err
+	}
+
+	// The store is append-only: record the revocation as a new version.
+	if err := certStore.AddCert(*c); err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("certificate was revoked at the CA but recording it failed: %w", err))
+	}
+	fmt.Printf("Revoked certificate '%s' (serial %s, reason %d)\n", c.Identifier, c.SerialNumber, reason)
+	return nil
+}
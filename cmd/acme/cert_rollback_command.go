@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// handleCertRollbackCommand restores the certificate the latest one of
+// identifier replaced and, unless noDeploy, pushes it to the configured
+// deployment targets.
+func handleCertRollbackCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, identifier string, noDeploy bool, logger *slog.Logger) error {
+	cfg, cfgErr := loadAcmeConfig(secureStore)
+	if identifier == "" {
+		if cfgErr != nil {
+			return fmt.Errorf("no -identifier given and %w", cfgErr)
+		}
+		if len(cfg.Domains) == 0 {
+			return withExitCode(exitConfig, fmt.Errorf("no -identifier given and the ACME config has no domains"))
+		}
+		identifier = cfg.Domains[0]
+	}
+
+	restored, replaced, err := certStore.Rollback(identifier, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rolled back '%s' from serial %s (expires %s) to serial %s (expires %s)\n",
+		identifier, replaced.SerialNumber, replaced.ExpiresAt.Format(time.RFC3339),
+		restored.SerialNumber, restored.ExpiresAt.Format(time.RFC3339))
+
+	if noDeploy {
+		return nil
+	}
+	if cfgErr != nil {
+		return fmt.Errorf("certificate restored, but not deployed: %w", cfgErr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), renewTimeout)
+	defer cancel()
+	handler, err := acme.NewCertRenewalHandler(cfg, secureStore, logger)
+	if err != nil {
+		return err
+	}
+	return handler.Deploy(ctx, restored)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+type certShowChainEntry struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+type certShowResult struct {
+	Identifier        string               `json:"identifier"`
+	Subject           string               `json:"subject"`
+	SANs              []string             `json:"sans"`
+	Serial            string               `json:"serial"`
+	KeyAlgorithm      string               `json:"key_algorithm"`
+	Signature         string               `json:"signature_algorithm"`
+	NotBefore         time.Time            `json:"not_before"`
+	NotAfter          time.Time            `json:"not_after"`
+	DaysRemaining     int                  `json:"days_remaining"`
+	FingerprintSHA256 string               `json:"fingerprint_sha256"`
+	FingerprintSHA1   string               `json:"fingerprint_sha1"`
+	SPKISHA256        string               `json:"spki_sha256"`
+	OCSPServers       []string             `json:"ocsp_servers"`
+	CRLDistribution   []string             `json:"crl_distribution_points"`
+	IssuingCAURLs     []string             `json:"issuing_ca_urls"`
+	SCTLogIDs         []string             `json:"sct_log_ids"`
+	RevokedAt         *time.Time           `json:"revoked_at,omitempty"`
+	Chain             []certShowChainEntry `json:"chain"`
+}
+
+func handleCertShowCommand(certStore *acme.SecureCertStore, identifier string, generation int, output string) error {
+	c, err := loadCert(certStore, identifier, generation)
+	if err != nil {
+		return err
+	}
+
+	chain, err := c.ParseChain()
+	if err != nil {
+		return fmt.Errorf("failed to parse stored certificate chain: %w", err)
+	}
+	leaf := chain[0]
+	sha256Sum := sha256.Sum256(leaf.Raw)
+	sha1Sum := sha1.Sum(leaf.Raw)
+	spkiSum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+
+	keyAlgorithm := c.KeyAlgorithm
+	if keyAlgorithm == "" {
+		keyAlgorithm = leaf.PublicKeyAlgorithm.String()
+	}
+
+	if output == outputJSON {
+		result := certShowResult{
+			Identifier:        c.Identifier,
+			Subject:           leaf.Subject.String(),
+			SANs:              leaf.DNSNames,
+			Serial:            fmt.Sprintf("%x", leaf.SerialNumber),
+			KeyAlgorithm:      keyAlgorithm,
+			Signature:         leaf.SignatureAlgorithm.String(),
+			NotBefore:         leaf.NotBefore.UTC(),
+			NotAfter:          leaf.NotAfter.UTC(),
+			DaysRemaining:     daysRemaining(leaf.NotAfter, time.Now()),
+			FingerprintSHA256: colonHex(sha256Sum[:]),
+			FingerprintSHA1:   colonHex(sha1Sum[:]),
+			SPKISHA256:        base64.StdEncoding.EncodeToString(spkiSum[:]),
+			OCSPServers:       leaf.OCSPServer,
+			CRLDistribution:   leaf.CRLDistributionPoints,
+			IssuingCAURLs:     leaf.IssuingCertificateURL,
+			SCTLogIDs:         c.SCTLogIDs,
+		}
+		if !c.RevokedAt.IsZero() {
+			result.RevokedAt = &c.RevokedAt
+		}
+		for _, cert := range chain {
+			result.Chain = append(result.Chain, certShowChainEntry{
+				Subject:   subjectLine(cert),
+				Issuer:    cert.Issuer.String(),
+				NotBefore: cert.NotBefore.UTC(),
+				NotAfter:  cert.NotAfter.UTC(),
+			})
+		}
+		return writeJSON(result)
+	}
+
+	printField("Identifier", c.Identifier)
+	printField("Subject", leaf.Subject.String())
+	printField("SANs", strings.Join(leaf.DNSNames, ", "))
+	printField("Serial", fmt.Sprintf("%x", leaf.SerialNumber))
+	printField("Key Algorithm", keyAlgorithm)
+	printField("Signature", leaf.SignatureAlgorithm.String())
+	printField("Not Before", leaf.NotBefore.UTC().Format(time.RFC3339))
+	printField("Not After", fmt.Sprintf("%s (%d days remaining)", leaf.NotAfter.UTC().Format(time.RFC3339), daysRemaining(leaf.NotAfter, time.Now())))
+	printField("SHA-256 Fingerprint", colonHex(sha256Sum[:]))
+	printField("SHA-1 Fingerprint", colonHex(sha1Sum[:]))
+	printField("SPKI SHA-256", base64.StdEncoding.EncodeToString(spkiSum[:]))
+	printField("OCSP Servers", joinOrNone(leaf.OCSPServer))
+	printField("CRL Distribution", joinOrNone(leaf.CRLDistributionPoints))
+	printField("Issuing CA URLs", joinOrNone(leaf.IssuingCertificateURL))
+	printField("SCT Logs", joinOrNone(c.SCTLogIDs))
+
+	fmt.Println("\nIssuer Chain:")
+	for i, cert := range chain {
+		fmt.Printf("  %d: %s\n", i, subjectLine(cert))
+		fmt.Printf("     issuer: %s, expires %s\n", cert.Issuer.String(), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// loadCert selects a certificate by identifier (latest version with that
+// identifier) or by generation when no identifier is given.
+func loadCert(certStore *acme.SecureCertStore, identifier string, generation int) (*acme.Cert, error) {
+	var (
+		c   *acme.Cert
+		err error
+	)
+	if identifier != "" {
+		c, err = certStore.ByIdentifier(identifier)
+	} else {
+		c, err = certStore.Generation(generation)
+	}
+	if err != nil {
+		return nil, withExitCode(exitStorage, err)
+	}
+	return c, nil
+}
+
+func printField(label, value string) {
+	fmt.Printf("%-21s %s\n", label+":", value)
+}
+
+func subjectLine(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// snippetPaths are the certificate files a server snippet refers to.
+type snippetPaths struct {
+	fullchain, key, combined string
+}
+
+// handleCertSnippetCommand prints the TLS stanza of server pointing at the
+// files written by `cert export -dir DIR`, or, without dir, at the
+// OutputFiles of the ACME config.
+func handleCertSnippetCommand(secureStore config.SecureStore, server, dir string) error {
+	var paths snippetPaths
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve '%s': %w", dir, err)
+		}
+		paths = snippetPaths{
+			fullchain: filepath.Join(abs, "fullchain.pem"),
+			key:       filepath.Join(abs, "privkey.pem"),
+			combined:  filepath.Join(abs, "combined.pem"),
+		}
+	} else {
+		cfg, err := loadAcmeConfig(secureStore)
+		if err != nil {
+			return err
+		}
+		paths = snippetPaths{
+			fullchain: cfg.OutputFiles.FullchainPath,
+			key:       cfg.OutputFiles.KeyPath,
+			combined:  cfg.OutputFiles.CombinedPath,
+		}
+	}
+
+	var snippet string
+	switch server {
+	case "nginx":
+		if paths.fullchain == "" || paths.key == "" {
+			return missingSnippetPaths(server, "FullchainPath and KeyPath")
+		}
+		snippet = fmt.Sprintf("ssl_certificate     %s;\nssl_certificate_key %s;\n", paths.fullchain, paths.key)
+	case "apache":
+		if paths.fullchain == "" || paths.key == "" {
+			return missingSnippetPaths(server, "FullchainPath and KeyPath")
+		}
+		// Since Apache 2.4.8 SSLCertificateFile may hold the intermediates.
+		snippet = fmt.Sprintf("SSLEngine on\nSSLCertificateFile    %s\nSSLCertificateKeyFile %s\n", paths.fullchain, paths.key)
+	case "caddy":
+		if paths.fullchain == "" || paths.key == "" {
+			return missingSnippetPaths(server, "FullchainPath and KeyPath")
+		}
+		snippet = fmt.Sprintf("tls %s %s\n", paths.fullchain, paths.key)
+	case "haproxy":
+		if paths.combined == "" {
+			return missingSnippetPaths(server, "CombinedPath")
+		}
+		snippet = fmt.Sprintf("bind :443 ssl crt %s\n", paths.combined)
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("unknown server '%s' (want nginx, apache, caddy or haproxy)", server))
+	}
+
+	fmt.Print(snippet)
+	return nil
+}
+
+func missingSnippetPaths(server, fields string) error {
+	return withExitCode(exitConfig, fmt.Errorf("%s snippet needs OutputFiles.%s in the ACME config, or use -dir with the directory of 'cert export'", server, fields))
+}
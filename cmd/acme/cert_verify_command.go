@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// handleCertVerifyCommand verifies the stored chain against the system roots
+// (plus rootsPath), the key against the leaf and the leaf against every
+// configured domain.
+func handleCertVerifyCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, identifier string, generation int, rootsPath, output string) error {
+	c, err := loadCert(certStore, identifier, generation)
+	if err != nil {
+		return err
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if rootsPath != "" {
+		pemData, err := os.ReadFile(rootsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read roots file '%s': %w", rootsPath, err)
+		}
+		if !roots.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no PEM encoded certificates found in roots file '%s'", rootsPath)
+		}
+	}
+
+	r := &doctorReport{json: output == outputJSON}
+
+	if chains, err := c.Verify(roots, time.Now()); err != nil {
+		r.fail("%v", err)
+	} else {
+		path := make([]string, len(chains[0]))
+		for i, cert := range chains[0] {
+			path[i] = subjectLine(cert)
+		}
+		r.pass("chain verifies: %s", strings.Join(path, " -> "))
+	}
+
+	if err := c.KeyMatchesLeaf(); err != nil {
+		r.fail("%v", err)
+	} else {
+		r.pass("private key matches the leaf certificate")
+	}
+
+	// Check the configured certificate against what renewals will request,
+	// any other against what it was stored for.
+	domains := c.Domains
+	if cfg, err := loadAcmeConfig(secureStore); err != nil {
+		r.warn("cannot load ACME config, checking the stored domains instead: %v", err)
+	} else if len(cfg.Domains) > 0 && cfg.Domains[0] == c.Identifier {
+		domains = cfg.Domains
+	}
+
+	chain, err := c.ParseChain()
+	if err != nil {
+		return withExitCode(exitStorage, err)
+	}
+	for _, domain := range domains {
+		if err := chain[0].VerifyHostname(domain); err != nil {
+			r.fail("%s is not covered by the leaf certificate", domain)
+		} else {
+			r.pass("%s is covered by the leaf certificate", domain)
+		}
+	}
+
+	return r.finish()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+// Exit codes of the check command, compatible with Nagios/Icinga plugins.
+const (
+	checkOK       = 0 // valid beyond the threshold
+	checkRenewDue = 1 // valid, but within the renewal threshold
+	checkCritical = 2 // expired, revoked, missing or unreadable
+)
+
+var checkStatusNames = map[int]string{
+	checkOK:       "OK",
+	checkRenewDue: "WARNING",
+	checkCritical: "CRITICAL",
+}
+
+type checkResult struct {
+	Status        string     `json:"status"`
+	ExitCode      int        `json:"exit_code"`
+	Message       string     `json:"message"`
+	Identifier    string     `json:"identifier,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	DaysRemaining *int       `json:"days_remaining,omitempty"`
+}
+
+// handleCheckCommand reports on the newest stored certificate (or the newest
+// with identifier) and returns the process exit code.
+func handleCheckCommand(certStore *acme.SecureCertStore, identifier string, thresholdDays int, output string) int {
+	code, message, c := checkCert(certStore, identifier, thresholdDays)
+
+	if output != outputJSON {
+		fmt.Printf("%s - %s\n", checkStatusNames[code], message)
+		return code
+	}
+
+	result := checkResult{
+		Status:   checkStatusNames[code],
+		ExitCode: code,
+		Message:  message,
+	}
+	if c != nil {
+		days := daysRemaining(c.ExpiresAt, time.Now())
+		result.Identifier = c.Identifier
+		result.ExpiresAt = &c.ExpiresAt
+		result.DaysRemaining = &days
+	}
+	if err := writeJSON(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return checkCritical
+	}
+	return code
+}
+
+// checkCert classifies the certificate and returns the exit code, a one-line
+// message and the certificate when one could be read.
+func checkCert(certStore *acme.SecureCertStore, identifier string, thresholdDays int) (int, string, *acme.Cert) {
+	var (
+		c   *acme.Cert
+		err error
+	)
+	if identifier != "" {
+		c, err = certStore.ByIdentifier(identifier)
+	} else {
+		c, err = certStore.Latest()
+	}
+	if err != nil {
+		return checkCritical, fmt.Sprintf("no usable certificate: %v", err), nil
+	}
+
+	now := time.Now()
+	days := daysRemaining(c.ExpiresAt, now)
+	switch {
+	case !c.RevokedAt.IsZero():
+		return checkCritical, fmt.Sprintf("%s was revoked at %s", c.Identifier, c.RevokedAt.Format(time.RFC3339)), c
+	case c.SelfSigned:
+		return checkRenewDue, fmt.Sprintf("%s is a self-signed bootstrap certificate (expires %s), renewal due", c.Identifier, c.ExpiresAt.Format(time.RFC3339)), c
+	case !now.Before(c.ExpiresAt):
+		return checkCritical, fmt.Sprintf("%s expired at %s", c.Identifier, c.ExpiresAt.Format(time.RFC3339)), c
+	case c.ExpiresAt.Sub(now) < time.Duration(thresholdDays)*24*time.Hour:
+		return checkRenewDue, fmt.Sprintf("%s expires in %d days (%s), renewal due", c.Identifier, days, c.ExpiresAt.Format(time.RFC3339)), c
+	default:
+		return checkOK, fmt.Sprintf("%s valid for %d days (expires %s)", c.Identifier, days, c.ExpiresAt.Format(time.RFC3339)), c
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// useSystemdCredentials is set by -systemd-creds.
+var useSystemdCredentials bool
+
+// configGeneration is set by -config-gen: the version of the ACME config the
+// commands use, 0 for the latest.
+var configGeneration int
+
+// loadAcmeConfig reads and unmarshals the latest ACME configuration, or the
+// -config-gen generation, in its stored format, resolves its ${env:NAME}
+// references, applies the ACME_* overrides of acme.ApplyEnvOverrides and the
+// defaults of acme.Config.SetDefaults. With -systemd-creds its secrets are
+// replaced by the systemd credentials present.
+func loadAcmeConfig(secureStore config.SecureStore) (*acme.Config, error) {
+	data, format, err := secureStore.Get(acme.ScopeConfig, configGeneration)
+	if err != nil {
+		return nil, withExitCode(exitStorage, fmt.Errorf("failed to load ACME config from scope '%s' generation %d: %w", acme.ScopeConfig, configGeneration, err))
+	}
+	defer acme.Zeroize(data)
+	if len(data) == 0 {
+		return nil, withExitCode(exitConfig, fmt.Errorf("ACME config in scope '%s' generation %d is empty", acme.ScopeConfig, configGeneration))
+	}
+
+	cfg, err := acme.ParseConfigFormat(data, format)
+	if err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+	if err := acme.ResolveEnvRefs(cfg); err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+	if err := acme.ApplyEnvOverrides(cfg); err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+	cfg.SetDefaults()
+	if useSystemdCredentials {
+		if err := acme.ApplySystemdCredentials(cfg); err != nil {
+			return nil, withExitCode(exitConfig, err)
+		}
+	}
+	return cfg, nil
+}
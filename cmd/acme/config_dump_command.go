@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+const redactedValue = "[REDACTED]"
+
+// secretKeyMarkers select, by case-insensitive substring of the key,
+// the values masked by -redact-secrets.
+var secretKeyMarkers = []string{"token", "secret", "password", "passphrase", "privatekey", "apikey", "credentialsjson"}
+
+// handleConfigDumpCommand writes a version of scope in outFormat, by default
+// its stored format.
+func handleConfigDumpCommand(secureStore config.SecureStore, scope string, generation int, output, outFormat string, redact bool) error {
+	data, format, err := secureStore.Get(scope, generation)
+	if err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("failed to retrieve scope '%s' generation %d: %w", scope, generation, err))
+	}
+	defer acme.Zeroize(data)
+
+	if outFormat == "" {
+		outFormat = format
+	}
+	if redact || outFormat != format {
+		data, err = convertDocument(data, format, outFormat, redact)
+		if err != nil {
+			if redact && outFormat == format {
+				return fmt.Errorf("cannot redact scope '%s' in format '%s' (use -redact-secrets=false to dump it as is): %w", scope, format, err)
+			}
+			return fmt.Errorf("failed to convert scope '%s' from '%s' to '%s': %w", scope, format, outFormat, err)
+		}
+	}
+
+	if output == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("failed to write to stdout: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote scope '%s' to %s\n", scope, output)
+	return nil
+}
+
+// convertDocument re-encodes data from one format to another. With redact,
+// every non-empty string value whose key looks like a secret is masked.
+func convertDocument(data []byte, from, to string, redact bool) ([]byte, error) {
+	var doc map[string]any
+	if err := acme.Decode(data, from, &doc); err != nil {
+		return nil, err
+	}
+	if redact {
+		redactMap(doc)
+	}
+	return acme.Encode(doc, to)
+}
+
+func redactMap(m map[string]any) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case map[string]any:
+			if strings.EqualFold(k, "credentials") {
+				// DNSProvider.Credentials: any name may hold a secret.
+				for name, cred := range val {
+					if s, ok := cred.(string); ok && s != "" {
+						val[name] = redactedValue
+					}
+				}
+				continue
+			}
+			redactMap(val)
+		case []any:
+			for _, item := range val {
+				if sub, ok := item.(map[string]any); ok {
+					redactMap(sub)
+				}
+			}
+		case string:
+			if val != "" && isSecretKey(k) {
+				m[k] = redactedValue
+			}
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// handleConfigSetCommand saves the ACME config in path as a new version of
+// the config scope, in its own format: format, or by default the one of the
+// file extension. The config must parse and validate.
+func handleConfigSetCommand(secureStore config.SecureStore, path, format, description string) error {
+	if format == "" {
+		format = acme.FormatFromPath(path)
+		if format == "" {
+			return withExitCode(exitUsage, fmt.Errorf("cannot tell the format of '%s' from its extension; use -format toml|json|yaml", path))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	defer acme.Zeroize(data)
+
+	cfg, err := acme.ParseConfigFormat(data, format)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	// Validated as it will be used; the file is saved without the defaults.
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+
+	if description == "" {
+		description = "ACME config set from " + path
+	}
+	if err := secureStore.Save(acme.ScopeConfig, data, format, description); err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("failed to save ACME config to scope '%s': %w", acme.ScopeConfig, err))
+	}
+	fmt.Printf("Saved %s config for %v into scope %s\n", format, cfg.Domains, acme.ScopeConfig)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+type deployResultEntry struct {
+	Target  string    `json:"target"`
+	At      time.Time `json:"at"`
+	Success bool      `json:"success"`
+	Skipped bool      `json:"skipped,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type deployReportEntry struct {
+	Identifier        string              `json:"identifier"`
+	FingerprintSHA256 string              `json:"fingerprint_sha256"`
+	ExpiresAt         time.Time           `json:"expires_at"`
+	Failed            bool                `json:"failed"`
+	Results           []deployResultEntry `json:"results"`
+}
+
+// handleDeployStatusCommand prints the last n deployment reports, newest
+// first.
+func handleDeployStatusCommand(secureStore config.SecureStore, n int, output string) error {
+	reports, err := acme.DeploymentHistory(secureStore, n)
+	if err != nil {
+		return withExitCode(exitStorage, err)
+	}
+
+	if output == outputJSON {
+		entries := make([]deployReportEntry, 0, len(reports))
+		for _, r := range reports {
+			entry := deployReportEntry{
+				Identifier:        r.Identifier,
+				FingerprintSHA256: r.FingerprintSHA256,
+				ExpiresAt:         r.ExpiresAt,
+				Failed:            r.Failed(),
+				Results:           make([]deployResultEntry, 0, len(r.Results)),
+			}
+			for _, res := range r.Results {
+				entry.Results = append(entry.Results, deployResultEntry(res))
+			}
+			entries = append(entries, entry)
+		}
+		return writeJSON(entries)
+	}
+
+	if len(reports) == 0 {
+		fmt.Printf("No deployment reports found in scope: %s\n", acme.ScopeAcmeDeployments)
+		return nil
+	}
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		status := "ok"
+		if r.Failed() {
+			status = "FAILED"
+		}
+		fingerprint := r.FingerprintSHA256
+		if len(fingerprint) > 16 {
+			fingerprint = fingerprint[:16]
+		}
+		fmt.Printf("%s  %s (fingerprint %s, expires %s)\n", status, r.Identifier, fingerprint, r.ExpiresAt.Format(time.RFC3339))
+		for _, res := range r.Results {
+			result := "ok"
+			switch {
+			case res.Skipped:
+				result = "skipped"
+			case !res.Success:
+				result = "FAILED: " + res.Error
+			}
+			fmt.Printf("  %s  %-30s  %s\n", res.At.Format(time.RFC3339), res.Target, result)
+		}
+	}
+	return nil
+}
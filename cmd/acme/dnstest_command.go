@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+func handleDNSTestCommand(secureStore config.SecureStore, domain string, timeout time.Duration, logger *slog.Logger) error {
+	cfg, err := loadAcmeConfig(secureStore)
+	if err != nil {
+		return err
+	}
+	if domain == "" {
+		if len(cfg.Domains) == 0 {
+			return withExitCode(exitConfig, fmt.Errorf("ACME config has no domains and no -domain was given"))
+		}
+		domain = cfg.Domains[0]
+	}
+
+	if err := acme.CheckDNSProvider(cfg, domain, timeout, logger); err != nil {
+		return withExitCode(exitDNS, err)
+	}
+	fmt.Printf("DNS provider '%s' can publish challenge records for %s\n", cfg.ActiveDNSProvider, domain)
+	return nil
+}
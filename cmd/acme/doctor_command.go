@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/miekg/dns"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// caaIdentities maps CA directory hosts to the issuer domain names they
+// expect in CAA records.
+var caaIdentities = map[string]string{
+	"acme-v02.api.letsencrypt.org":         "letsencrypt.org",
+	"acme-staging-v02.api.letsencrypt.org": "letsencrypt.org",
+}
+
+type doctorCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// doctorReport prints each check as it completes, or collects them for a
+// single JSON document when json is set.
+type doctorReport struct {
+	json     bool
+	checks   []doctorCheck
+	failures int
+}
+
+func (r *doctorReport) add(status, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if r.json {
+		r.checks = append(r.checks, doctorCheck{Status: status, Message: message})
+		return
+	}
+	fmt.Printf("[%s] %s\n", strings.ToUpper(status), message)
+}
+
+func (r *doctorReport) pass(format string, args ...any) {
+	r.add("pass", format, args...)
+}
+
+func (r *doctorReport) warn(format string, args ...any) {
+	r.add("warn", format, args...)
+}
+
+func (r *doctorReport) fail(format string, args ...any) {
+	r.failures++
+	r.add("fail", format, args...)
+}
+
+// finish writes the JSON document and returns an error when any check failed.
+func (r *doctorReport) finish() error {
+	if r.json {
+		err := writeJSON(struct {
+			Checks   []doctorCheck `json:"checks"`
+			Failures int           `json:"failures"`
+		}{r.checks, r.failures})
+		if err != nil {
+			return err
+		}
+	}
+	if r.failures > 0 {
+		return fmt.Errorf("%d check(s) failed", r.failures)
+	}
+	if !r.json {
+		fmt.Println("All checks passed.")
+	}
+	return nil
+}
+
+// handleDoctorCommand runs the preflight checks and returns an error when
+// any of them failed.
+func handleDoctorCommand(pool *sqlitex.Pool, secureStore config.SecureStore, output string) error {
+	r := &doctorReport{json: output == outputJSON}
+
+	checkSchema(r, pool)
+
+	cfg, err := loadAcmeConfig(secureStore)
+	if err != nil {
+		r.fail("ACME config: %v", err)
+		return r.finish()
+	}
+	r.pass("ACME config loaded from scope %s", acme.ScopeConfig)
+
+	if _, err := acme.ParseAccountKey(cfg); err != nil {
+		r.fail("ACME account key: %v", err)
+	} else {
+		r.pass("ACME account key parses")
+	}
+
+	if provider, ok := cfg.DNSProviders[cfg.ActiveDNSProvider]; cfg.ActiveDNSProvider == "" || !ok {
+		r.fail("ActiveDNSProvider '%s' has no entry in DNSProviders", cfg.ActiveDNSProvider)
+	} else {
+		r.pass("DNS provider '%s' configured", cfg.ActiveDNSProvider)
+		if cfg.ActiveDNSProvider == acme.DNSProviderCloudflare {
+			checkCloudflareToken(r, provider, cfg.Domains)
+		}
+	}
+
+	checkCADirectory(r, cfg.CADirectoryURL)
+
+	if len(cfg.Domains) == 0 {
+		r.fail("no domains configured")
+	}
+	caIdentity := ""
+	if u, err := url.Parse(cfg.CADirectoryURL); err == nil {
+		caIdentity = caaIdentities[u.Hostname()]
+	}
+	for _, domain := range cfg.Domains {
+		checkNameservers(r, domain)
+		checkCAA(r, domain, caIdentity)
+	}
+
+	return r.finish()
+}
+
+func checkCloudflareToken(r *doctorReport, provider acme.DNSProvider, domains []string) {
+	token, err := acme.ReadSecret(provider.Credential("APIToken"))
+	if err == nil {
+		err = acme.CheckCloudflareToken(context.Background(), token, domains)
+	}
+	if err != nil {
+		r.fail("Cloudflare token: %v", err)
+		return
+	}
+	r.pass("Cloudflare token is active and can access the zones of all domains")
+}
+
+func checkSchema(r *doctorReport, pool *sqlitex.Pool) {
+	conn, err := pool.Take(context.Background())
+	if err != nil {
+		r.fail("database connection: %v", err)
+		return
+	}
+	defer pool.Put(conn)
+
+	found := false
+	err = sqlitex.Execute(conn, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'app_config'", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			found = true
+			return nil
+		},
+	})
+	switch {
+	case err != nil:
+		r.fail("database schema: %v", err)
+	case !found:
+		r.fail("database schema: table app_config is missing (initialize the restinpieces database first)")
+	default:
+		r.pass("database schema: app_config table present")
+	}
+}
+
+func checkCADirectory(r *doctorReport, directoryURL string) {
+	if directoryURL == "" {
+		r.fail("CADirectoryURL is empty")
+		return
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(directoryURL)
+	if err != nil {
+		r.fail("CA directory %s unreachable: %v", directoryURL, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r.fail("CA directory %s returned HTTP %d", directoryURL, resp.StatusCode)
+		return
+	}
+
+	var directory struct {
+		NewOrder string `json:"newOrder"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&directory); err != nil || directory.NewOrder == "" {
+		r.fail("CA directory %s is not an ACME directory", directoryURL)
+		return
+	}
+	r.pass("CA directory %s resolves", directoryURL)
+}
+
+func checkNameservers(r *doctorReport, domain string) {
+	fqdn := dns01.ToFqdn(strings.TrimPrefix(domain, "*."))
+	zone, err := dns01.FindZoneByFqdn(fqdn)
+	if err != nil {
+		r.fail("%s: cannot find DNS zone: %v", domain, err)
+		return
+	}
+
+	resp, err := dnsLookup(zone, dns.TypeNS)
+	if err != nil {
+		r.fail("%s: NS lookup for zone %s failed: %v", domain, zone, err)
+		return
+	}
+	var nameservers []string
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			nameservers = append(nameservers, ns.Ns)
+		}
+	}
+	if len(nameservers) == 0 {
+		r.fail("%s: zone %s has no authoritative NS records", domain, zone)
+		return
+	}
+	r.pass("%s: zone %s served by %s", domain, zone, strings.Join(nameservers, ", "))
+}
+
+// checkCAA looks up the closest CAA record set, walking up from the domain
+// as CAs do, and checks it authorizes caIdentity.
+func checkCAA(r *doctorReport, domain, caIdentity string) {
+	wildcard := strings.HasPrefix(domain, "*.")
+	name := strings.TrimPrefix(domain, "*.")
+	labels := dns.SplitDomainName(name)
+
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		resp, err := dnsLookup(dns.Fqdn(candidate), dns.TypeCAA)
+		if err != nil {
+			r.fail("%s: CAA lookup for %s failed: %v", domain, candidate, err)
+			return
+		}
+		// CAs refuse to issue when the CAA lookup errors rather than being empty.
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			r.fail("%s: CAA lookup for %s returned %s", domain, candidate, dns.RcodeToString[resp.Rcode])
+			return
+		}
+
+		var issue, issueWild []string
+		for _, rr := range resp.Answer {
+			caa, ok := rr.(*dns.CAA)
+			if !ok {
+				continue
+			}
+			// Parameters after ';' are not part of the issuer name.
+			value := strings.TrimSpace(strings.SplitN(caa.Value, ";", 2)[0])
+			switch caa.Tag {
+			case "issue":
+				issue = append(issue, value)
+			case "issuewild":
+				issueWild = append(issueWild, value)
+			}
+		}
+		if len(issue) == 0 && len(issueWild) == 0 {
+			continue
+		}
+
+		allowed := issue
+		if wildcard && len(issueWild) > 0 {
+			allowed = issueWild
+		}
+		switch {
+		case caIdentity == "":
+			r.warn("%s: CAA at %s allows %v; cannot tell which name the configured CA uses", domain, candidate, allowed)
+		case slices.Contains(allowed, caIdentity):
+			r.pass("%s: CAA at %s allows %s", domain, candidate, caIdentity)
+		default:
+			r.fail("%s: CAA at %s allows %v but not %s", domain, candidate, allowed, caIdentity)
+		}
+		return
+	}
+	r.pass("%s: no CAA records, any CA may issue", domain)
+}
+
+func dnsLookup(fqdn string, rtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, rtype)
+	m.RecursionDesired = true
+
+	client := &dns.Client{Timeout: 10 * time.Second}
+	var lastErr error
+	for _, resolver := range acme.PublicResolvers {
+		resp, _, err := client.Exchange(m, resolver)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
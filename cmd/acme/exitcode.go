@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caasmo/restinpieces-acme"
+	legoacme "github.com/go-acme/lego/v4/acme"
+)
+
+// Exit codes of all commands except check, which keeps the Nagios/Icinga
+// convention. Wrapper scripts and systemd OnFailure= units can branch on the
+// class of failure.
+const (
+	exitOK          = 0
+	exitFailure     = 1 // unclassified failure
+	exitUsage       = 2 // invalid flags or arguments
+	exitConfig      = 3 // acme_config missing, unreadable or invalid
+	exitStorage     = 4 // database or secure store failure
+	exitDNS         = 5 // DNS provider or propagation failure
+	exitCA          = 6 // the ACME CA rejected a request or is unreachable
+	exitRateLimited = 7 // the ACME CA rate limited the account
+)
+
+// ACME problem types (RFC 8555 section 6.7) with their own exit code.
+const (
+	problemRateLimited = "urn:ietf:params:acme:error:rateLimited"
+	problemDNS         = "urn:ietf:params:acme:error:dns"
+)
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode classifies err. Problem documents returned by the CA take
+// precedence over the class attached by the command, as they are the more
+// specific cause.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var problem *legoacme.ProblemDetails
+	if errors.As(err, &problem) {
+		switch problem.Type {
+		case problemRateLimited:
+			return exitRateLimited
+		case problemDNS:
+			return exitDNS
+		default:
+			return exitCA
+		}
+	}
+	var rateLimited *acme.ErrRateLimited
+	switch {
+	case errors.As(err, &rateLimited):
+		return exitRateLimited
+	case errors.Is(err, acme.ErrDNSPropagationTimeout):
+		return exitDNS
+	case errors.Is(err, acme.ErrConfigInvalid):
+		return exitConfig
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+// fatal prints err and exits with its exit code.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+)
+
+// handleExportMetricsCommand writes node_exporter textfile collector metrics
+// for the newest stored certificate of every identifier. The file is
+// replaced atomically so the collector never reads a partial write; "-"
+// prints to stdout.
+func handleExportMetricsCommand(certStore *acme.SecureCertStore, path string) error {
+	certs, err := certStore.History()
+	if err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("failed to list certificates: %w", err))
+	}
+
+	var buf bytes.Buffer
+	if err := acme.WriteCertMetrics(&buf, certs, time.Now()); err != nil {
+		return err
+	}
+
+	if path == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return acme.WriteFileAtomic(path, buf.Bytes(), 0644, -1, -1)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// handleGenerateSelfSignedCommand stores a self-signed bootstrap certificate
+// for the configured domains.
+func handleGenerateSelfSignedCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, validity time.Duration, force bool) error {
+	cfg, err := loadAcmeConfig(secureStore)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Domains) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("ACME config has no domains"))
+	}
+
+	// Never shadow a real certificate unless asked to.
+	if stored, err := certStore.ByIdentifier(cfg.Domains[0]); err == nil && !stored.SelfSigned && !force {
+		return withExitCode(exitUsage, fmt.Errorf("a CA issued certificate for '%s' is already stored (expires %s); use -force to replace it", stored.Identifier, stored.ExpiresAt.Format(time.RFC3339)))
+	}
+
+	c, err := acme.NewSelfSignedCert(cfg.Domains[0], cfg.Domains, validity)
+	if err != nil {
+		return err
+	}
+	if err := certStore.AddCert(*c); err != nil {
+		return withExitCode(exitStorage, err)
+	}
+	fmt.Printf("Stored self-signed certificate '%s' for %v (expires %s) in scope %s\n", c.Identifier, c.Domains, c.ExpiresAt.Format(time.RFC3339), certStore.Scope())
+	return nil
+}
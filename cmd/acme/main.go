@@ -0,0 +1,497 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+	dbz "github.com/caasmo/restinpieces/db/zombiezen"
+)
+
+func main() {
+	// Global flags
+	ageIdentityPathFlag := flag.String("age-key", "", "Path to the age identity file (private key 'AGE-SECRET-KEY-1...')")
+	ageRecipientsFlag := flag.String("age-recipients", "", "File of additional age recipients (age1..., one per line) saved versions are also encrypted to")
+	kmsFlag := flag.String("kms", "", "Encrypt with a KMS instead of age: awskms://KEY?region=R, gcpkms://projects/... or vault://MOUNT/KEY (-age-key then reads older versions and saves the application config)")
+	dbPathFlag := flag.String("db", "", "Path to the SQLite database file")
+	scopePrefixFlag := flag.String("scope-prefix", "", "Prefix of the acme_* scope names, to keep several independent configurations in one database")
+	readOnlyFlag := flag.Bool("read-only", false, "Open the database read-only (default for commands that never write)")
+	busyTimeoutFlag := flag.Duration("busy-timeout", acme.DefaultBusyTimeout, "How long to wait for database locks held by other processes")
+	poolSizeFlag := flag.Int("pool-size", 0, "Number of database connections (0 = one per CPU)")
+	logFormatFlag := flag.String("log-format", acme.LogFormatText, "Log format: text or json")
+	logLevelFlag := flag.String("log-level", "", "Log level: debug, info, warn or error (default info)")
+	quietFlag := flag.Bool("quiet", false, "Only log warnings and errors")
+	debugFlag := flag.Bool("debug", false, "Log debug messages (also LOG_LEVEL=debug)")
+	systemdCredsFlag := flag.Bool("systemd-creds", false, "Read the age key and the ACME/DNS secrets from systemd's $"+acme.CredentialsDirectoryEnv)
+	configGenFlag := flag.Int("config-gen", 0, "Use this version of the ACME config, counting back from the latest (0), e.g. to try a candidate before promoting it")
+	outputFlag := flag.String("output", outputText, "Output format of cert list, cert show, cert verify, check, deploy status, doctor and report: text or json")
+
+	originalUsage := flag.Usage
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [global options] <command> [command-specific options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Manages ACME certificates stored in the secure store.\n\n")
+		fmt.Fprintf(os.Stderr, "Global Options:\n")
+		originalUsage() // Prints the global flags
+		fmt.Fprintf(os.Stderr, "\nEvery global option can also be set with an environment variable, e.g. %s for -db or %s for -age-key.\n", acme.FlagEnvVar("db"), acme.FlagEnvVar("age-key"))
+		fmt.Fprintf(os.Stderr, "\nAvailable Commands:\n")
+		fmt.Fprintf(os.Stderr, "  cert list                          List stored certificates (scope: %s)\n", acme.ScopeAcmeCertificate)
+		fmt.Fprintf(os.Stderr, "  cert show [-identifier ID] [-gen N]\n")
+		fmt.Fprintf(os.Stderr, "                                     Show parsed details of a stored certificate (default: latest)\n")
+		fmt.Fprintf(os.Stderr, "  cert verify [-identifier ID] [-gen N] [-roots FILE]\n")
+		fmt.Fprintf(os.Stderr, "                                     Verify the chain, the key and the coverage of every configured domain\n")
+		fmt.Fprintf(os.Stderr, "  cert export [-identifier ID] [-gen N] -dir DIR\n")
+		fmt.Fprintf(os.Stderr, "                                     Write cert.pem, chain.pem, fullchain.pem, privkey.pem and combined.pem (0600) to DIR\n")
+		fmt.Fprintf(os.Stderr, "  cert snippet -server nginx|apache|caddy|haproxy [-dir DIR]\n")
+		fmt.Fprintf(os.Stderr, "                                     Print the server's TLS stanza for the exported files (default: OutputFiles paths)\n")
+		fmt.Fprintf(os.Stderr, "  cert convert [-identifier ID] [-gen N] [-format p12|jks] -out FILE -passphrase-file FILE\n")
+		fmt.Fprintf(os.Stderr, "                                     Write a passphrase protected PKCS#12 or JKS bundle (0600)\n")
+		fmt.Fprintf(os.Stderr, "  cert import [-identifier ID] -cert FULLCHAIN -key PRIVKEY\n")
+		fmt.Fprintf(os.Stderr, "                                     Import an existing PEM certificate/key pair (e.g. from certbot)\n")
+		fmt.Fprintf(os.Stderr, "  cert revoke [-identifier ID] [-gen N] [-reason REASON]\n")
+		fmt.Fprintf(os.Stderr, "                                     Revoke a stored certificate at the CA and record it (default reason: unspecified)\n")
+		fmt.Fprintf(os.Stderr, "  cert rollback [-identifier ID] [-no-deploy]\n")
+		fmt.Fprintf(os.Stderr, "                                     Restore the certificate the latest one replaced and deploy it again\n")
+		fmt.Fprintf(os.Stderr, "  renew [-identifier ID] [-domain DOMAIN] [-cron | -daemon [-interval D]] [-days N]\n")
+		fmt.Fprintf(os.Stderr, "                                     Obtain a new certificate now, optionally only the one matching the filter\n")
+		fmt.Fprintf(os.Stderr, "                                     -cron: exit 0 without contacting the CA unless renewal is due\n")
+		fmt.Fprintf(os.Stderr, "                                     -daemon: keep running, re-checking every interval (default 12h)\n")
+		fmt.Fprintf(os.Stderr, "  generate-selfsigned [-validity D] [-force]\n")
+		fmt.Fprintf(os.Stderr, "                                     Store a self-signed bootstrap certificate for the configured domains\n")
+		fmt.Fprintf(os.Stderr, "  dns test [-domain DOMAIN] [-timeout DURATION]\n")
+		fmt.Fprintf(os.Stderr, "                                     Create and delete a throwaway _acme-challenge TXT record, checking public resolvers\n")
+		fmt.Fprintf(os.Stderr, "  selftest [-roots FILE] [-timeout DURATION] [-keep]\n")
+		fmt.Fprintf(os.Stderr, "                                     Issue a certificate from the Let's Encrypt staging CA into temporary scopes, then delete them\n")
+		fmt.Fprintf(os.Stderr, "  deploy status [-n N]               Show the per-target deployment results of the last N renewals (default 5)\n")
+		fmt.Fprintf(os.Stderr, "  doctor                             Preflight checks (schema, config, account key, CA directory, NS, CAA)\n")
+		fmt.Fprintf(os.Stderr, "  check [-identifier ID] [-days N]   Exit 0 if valid beyond N days (default 30), 1 if renewal is due,\n")
+		fmt.Fprintf(os.Stderr, "                                     2 if expired, revoked or missing\n")
+		fmt.Fprintf(os.Stderr, "  report [-days N] [-format text|json|html]\n")
+		fmt.Fprintf(os.Stderr, "                                     Summary of every certificate: days to expiry, last renewal, next renewal\n")
+		fmt.Fprintf(os.Stderr, "  export-metrics -file FILE          Write node_exporter textfile metrics (expiry, last renewal) to FILE\n")
+		fmt.Fprintf(os.Stderr, "  prune [-scope SCOPE] [-keep N] [-older-than DURATION] [-dry-run]\n")
+		fmt.Fprintf(os.Stderr, "                                     Delete versions of the acme scopes beyond the newest N (default 10)\n")
+		fmt.Fprintf(os.Stderr, "  config dump [-scope SCOPE] [-gen N] [-o FILE] [-format toml|json|yaml] [-redact-secrets=false]\n")
+		fmt.Fprintf(os.Stderr, "                                     Print a decrypted scope (default: %s) with secrets masked\n", acme.ScopeConfig)
+		fmt.Fprintf(os.Stderr, "  config set -file FILE [-format toml|json|yaml] [-description TEXT]\n")
+		fmt.Fprintf(os.Stderr, "                                     Validate and save a new ACME config (format from the extension by default)\n")
+	}
+
+	if err := acme.FlagsFromEnv(flag.CommandLine, envFlags...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	flag.Parse()
+
+	if *systemdCredsFlag {
+		useSystemdCredentials = true
+		if *ageIdentityPathFlag == "" {
+			path, err := acme.SystemdCredentialPath(acme.CredentialAgeKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitUsage)
+			}
+			*ageIdentityPathFlag = path
+		}
+	}
+	if *ageIdentityPathFlag == "" && *kmsFlag == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing required global flag: -age-key (or -kms)\n")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if *dbPathFlag == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing required global flag: -db\n")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *configGenFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -config-gen cannot be negative\n")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	configGeneration = *configGenFlag
+
+	if err := validOutputFormat(*outputFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	logLevel, err := acme.LogLevel(*logLevelFlag, *quietFlag, *debugFlag || os.Getenv("LOG_LEVEL") == "debug")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	logger, err := acme.NewLogger(os.Stdout, *logFormatFlag, logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	slog.SetDefault(logger) // Set globally for libraries that might use slog's default
+
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Error: missing command\n")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	command := args[0]
+	commandArgs := args[1:]
+
+	subcommand := ""
+	if len(commandArgs) > 0 {
+		subcommand = commandArgs[0]
+	}
+	writes := commandWrites(command, subcommand)
+	if *readOnlyFlag && writes {
+		name := command
+		if command == "cert" || command == "config" {
+			name += " " + subcommand
+		}
+		fmt.Fprintf(os.Stderr, "Error: '%s' writes to the database and cannot run with -read-only\n", name)
+		os.Exit(exitUsage)
+	}
+
+	pool, err := acme.NewPool(*dbPathFlag, acme.PoolConfig{
+		BusyTimeout: *busyTimeoutFlag,
+		PoolSize:    *poolSizeFlag,
+		ReadOnly:    !writes,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create database pool (db_path: %s): %v\n", *dbPathFlag, err)
+		os.Exit(exitStorage)
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: error closing database pool: %v\n", err)
+		}
+	}()
+
+	dbImpl, err := dbz.New(pool)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to instantiate zombiezen db from pool: %v\n", err)
+		os.Exit(exitStorage)
+	}
+
+	var secureStore config.SecureStore
+	if *ageIdentityPathFlag != "" {
+		secureStore, err = acme.NewSecureStore(dbImpl, *ageIdentityPathFlag, *ageRecipientsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to instantiate secure store (age, age_key_path: %s): %v\n", *ageIdentityPathFlag, err)
+			os.Exit(exitStorage)
+		}
+	}
+	scopes := acme.DefaultScopes().WithPrefix(*scopePrefixFlag)
+	if *kmsFlag != "" {
+		// The self-test saves under its own scopes, whatever the prefix.
+		selftestScopes := acme.DefaultScopes().WithPrefix(selftestScopePrefix)
+		secureStore, err = acme.NewKMSSecureStore(dbImpl, *kmsFlag, secureStore, scopes, selftestScopes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to instantiate secure store (kms: %s): %v\n", *kmsFlag, err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *scopePrefixFlag != "" {
+		secureStore = acme.NewScopedStore(secureStore, scopes)
+	}
+	certStore, err := acme.NewSecureCertStore(secureStore, acme.ScopeAcmeCertificate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitStorage)
+	}
+
+	switch command {
+	case "cert":
+		if len(commandArgs) < 1 {
+			fmt.Fprintf(os.Stderr, "Error: 'cert' requires a subcommand\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		runCertCommand(secureStore, certStore, logger, *outputFlag, commandArgs[0], commandArgs[1:])
+	case "config":
+		if len(commandArgs) < 1 {
+			fmt.Fprintf(os.Stderr, "Error: 'config' requires a subcommand\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		runConfigCommand(secureStore, commandArgs[0], commandArgs[1:])
+	case "renew":
+		renewCmd := flag.NewFlagSet("renew", flag.ExitOnError)
+		identifier := renewCmd.String("identifier", "", "Only renew the certificate with this identifier")
+		domain := renewCmd.String("domain", "", "Only renew the certificate covering this domain")
+		cron := renewCmd.Bool("cron", false, "Check expiry first and only renew when due (safe for a daily crontab)")
+		daemon := renewCmd.Bool("daemon", false, "Keep running and renew whenever due, until SIGTERM")
+		interval := renewCmd.Duration("interval", 12*time.Hour, "Check interval for -daemon")
+		days := renewCmd.Int("days", 0, "Renewal threshold in days for -cron and -daemon (default: RenewalThreshold of the config, 30 days)")
+		renewCmd.Parse(commandArgs)
+		opts := renewOptions{
+			identifier: *identifier,
+			domain:     *domain,
+			cron:       *cron,
+			threshold:  time.Duration(*days) * 24 * time.Hour,
+			daemon:     *daemon,
+			interval:   *interval,
+		}
+		if err := handleRenewCommand(secureStore, certStore, opts, logger); err != nil {
+			fatal(err)
+		}
+	case "generate-selfsigned":
+		selfSignedCmd := flag.NewFlagSet("generate-selfsigned", flag.ExitOnError)
+		validity := selfSignedCmd.Duration("validity", acme.DefaultSelfSignedValidity, "Lifetime of the bootstrap certificate")
+		force := selfSignedCmd.Bool("force", false, "Store it even if a CA issued certificate exists")
+		selfSignedCmd.Parse(commandArgs)
+		if err := handleGenerateSelfSignedCommand(secureStore, certStore, *validity, *force); err != nil {
+			fatal(err)
+		}
+	case "export-metrics":
+		metricsCmd := flag.NewFlagSet("export-metrics", flag.ExitOnError)
+		file := metricsCmd.String("file", "", "Output .prom file in the textfile collector directory, - for stdout (required)")
+		metricsCmd.Parse(commandArgs)
+		if *file == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'export-metrics' requires -file\n")
+			metricsCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		if err := handleExportMetricsCommand(certStore, *file); err != nil {
+			fatal(err)
+		}
+	case "prune":
+		pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+		scope := pruneCmd.String("scope", "", "Only prune this scope (default: every acme_* scope)")
+		keep := pruneCmd.Int("keep", 10, "Number of newest versions to keep per scope")
+		olderThan := pruneCmd.Duration("older-than", 0, "Only delete versions older than this (e.g. 2160h)")
+		dryRun := pruneCmd.Bool("dry-run", false, "Show what would be removed without deleting")
+		pruneCmd.Parse(commandArgs)
+		pruneScopes := scopes.All()
+		if *scope != "" {
+			pruneScopes = []string{*scope}
+		}
+		if err := handlePruneCommand(pool, pruneScopes, *keep, *olderThan, *dryRun); err != nil {
+			fatal(err)
+		}
+	case "dns":
+		if len(commandArgs) < 1 || commandArgs[0] != "test" {
+			fmt.Fprintf(os.Stderr, "Error: 'dns' requires the 'test' subcommand\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		dnsTestCmd := flag.NewFlagSet("dns test", flag.ExitOnError)
+		domain := dnsTestCmd.String("domain", "", "Domain to test (default: first configured domain)")
+		timeout := dnsTestCmd.Duration("timeout", 10*time.Minute, "How long to wait for the record to propagate")
+		dnsTestCmd.Parse(commandArgs[1:])
+		if err := handleDNSTestCommand(secureStore, *domain, *timeout, logger); err != nil {
+			fatal(err)
+		}
+	case "selftest":
+		selftestCmd := flag.NewFlagSet("selftest", flag.ExitOnError)
+		roots := selftestCmd.String("roots", "", "PEM file with the staging CA roots (default: download them from letsencrypt.org)")
+		timeout := selftestCmd.Duration("timeout", renewTimeout, "How long the complete self-test may take")
+		keep := selftestCmd.Bool("keep", false, "Keep the "+selftestScopePrefix+"* scopes for inspection")
+		selftestCmd.Parse(commandArgs)
+		if err := handleSelftestCommand(pool, secureStore, *roots, *timeout, *keep, logger); err != nil {
+			fatal(err)
+		}
+	case "deploy":
+		if len(commandArgs) < 1 || commandArgs[0] != "status" {
+			fmt.Fprintf(os.Stderr, "Error: 'deploy' requires the 'status' subcommand\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		statusCmd := flag.NewFlagSet("deploy status", flag.ExitOnError)
+		n := statusCmd.Int("n", 5, "Number of most recent renewals to show")
+		statusCmd.Parse(commandArgs[1:])
+		if err := handleDeployStatusCommand(secureStore, *n, *outputFlag); err != nil {
+			fatal(err)
+		}
+	case "doctor":
+		if len(commandArgs) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: 'doctor' does not take any arguments\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		if err := handleDoctorCommand(pool, secureStore, *outputFlag); err != nil {
+			fatal(err)
+		}
+	case "report":
+		reportCmd := flag.NewFlagSet("report", flag.ExitOnError)
+		days := reportCmd.Int("days", defaultThresholdDays, "Renewal threshold in days")
+		format := reportCmd.String("format", "", "Report format: text, json or html (default: -output)")
+		reportCmd.Parse(commandArgs)
+		if *format == "" {
+			*format = *outputFlag
+		}
+		if err := handleReportCommand(secureStore, *days, *format); err != nil {
+			fatal(err)
+		}
+	case "check":
+		checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+		identifier := checkCmd.String("identifier", "", "Check the latest certificate with this identifier")
+		days := checkCmd.Int("days", defaultThresholdDays, "Renewal threshold in days")
+		checkCmd.Parse(commandArgs)
+		os.Exit(handleCheckCommand(certStore, *identifier, *days, *outputFlag))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command: %s\n", command)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+func runCertCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, logger *slog.Logger, output, subcommand string, args []string) {
+	var err error
+	switch subcommand {
+	case "list":
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: 'cert list' does not take any arguments\n")
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleCertListCommand(certStore, output)
+	case "show":
+		showCmd := flag.NewFlagSet("cert show", flag.ExitOnError)
+		identifier := showCmd.String("identifier", "", "Show the latest certificate with this identifier")
+		gen := showCmd.Int("gen", 0, "Generation to show when no identifier is given (0 = latest)")
+		showCmd.Parse(args)
+		err = handleCertShowCommand(certStore, *identifier, *gen, output)
+	case "verify":
+		verifyCmd := flag.NewFlagSet("cert verify", flag.ExitOnError)
+		identifier := verifyCmd.String("identifier", "", "Verify the latest certificate with this identifier")
+		gen := verifyCmd.Int("gen", 0, "Generation to verify when no identifier is given (0 = latest)")
+		roots := verifyCmd.String("roots", "", "PEM file with additional trusted roots (e.g. the staging CA roots)")
+		verifyCmd.Parse(args)
+		err = handleCertVerifyCommand(secureStore, certStore, *identifier, *gen, *roots, output)
+	case "export":
+		exportCmd := flag.NewFlagSet("cert export", flag.ExitOnError)
+		identifier := exportCmd.String("identifier", "", "Export the latest certificate with this identifier")
+		gen := exportCmd.Int("gen", 0, "Generation to export when no identifier is given (0 = latest)")
+		dir := exportCmd.String("dir", "", "Target directory for the PEM files (required)")
+		exportCmd.Parse(args)
+		if *dir == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'cert export' requires -dir\n")
+			exportCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleCertExportCommand(certStore, *identifier, *gen, *dir)
+	case "snippet":
+		snippetCmd := flag.NewFlagSet("cert snippet", flag.ExitOnError)
+		server := snippetCmd.String("server", "", "Web server: nginx, apache, caddy or haproxy (required)")
+		dir := snippetCmd.String("dir", "", "Directory written by 'cert export' (default: OutputFiles paths of the ACME config)")
+		snippetCmd.Parse(args)
+		if *server == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'cert snippet' requires -server\n")
+			snippetCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleCertSnippetCommand(secureStore, *server, *dir)
+	case "convert":
+		convertCmd := flag.NewFlagSet("cert convert", flag.ExitOnError)
+		identifier := convertCmd.String("identifier", "", "Convert the latest certificate with this identifier")
+		gen := convertCmd.Int("gen", 0, "Generation to convert when no identifier is given (0 = latest)")
+		format := convertCmd.String("format", "p12", "Bundle format: p12 or jks")
+		out := convertCmd.String("out", "", "Output file (required)")
+		passphraseFile := convertCmd.String("passphrase-file", "", "File whose first line is the bundle passphrase, - for stdin (required)")
+		alias := convertCmd.String("alias", "", "JKS entry alias (default: certificate identifier)")
+		convertCmd.Parse(args)
+		if *out == "" || *passphraseFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'cert convert' requires -out and -passphrase-file\n")
+			convertCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleCertConvertCommand(certStore, *identifier, *gen, *format, *out, *passphraseFile, *alias)
+	case "import":
+		importCmd := flag.NewFlagSet("cert import", flag.ExitOnError)
+		identifier := importCmd.String("identifier", "", "Identifier to store the certificate under (default: first SAN)")
+		certPath := importCmd.String("cert", "", "Path to the PEM certificate chain, leaf first (required)")
+		keyPath := importCmd.String("key", "", "Path to the PEM private key (required)")
+		importCmd.Parse(args)
+		if *certPath == "" || *keyPath == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'cert import' requires -cert and -key\n")
+			importCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleCertImportCommand(certStore, *identifier, *certPath, *keyPath)
+	case "revoke":
+		revokeCmd := flag.NewFlagSet("cert revoke", flag.ExitOnError)
+		identifier := revokeCmd.String("identifier", "", "Revoke the latest certificate with this identifier")
+		gen := revokeCmd.Int("gen", 0, "Generation to revoke when no identifier is given (0 = latest)")
+		reason := revokeCmd.String("reason", "unspecified", "Revocation reason name or RFC 5280 code")
+		revokeCmd.Parse(args)
+		err = handleCertRevokeCommand(secureStore, certStore, *identifier, *gen, *reason, logger)
+	case "rollback":
+		rollbackCmd := flag.NewFlagSet("cert rollback", flag.ExitOnError)
+		identifier := rollbackCmd.String("identifier", "", "Roll back the certificate with this identifier (default: first configured domain)")
+		noDeploy := rollbackCmd.Bool("no-deploy", false, "Only restore it in the store, without running the deployment targets")
+		rollbackCmd.Parse(args)
+		err = handleCertRollbackCommand(secureStore, certStore, *identifier, *noDeploy, logger)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown cert subcommand: %s\n", subcommand)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runConfigCommand(secureStore config.SecureStore, subcommand string, args []string) {
+	var err error
+	switch subcommand {
+	case "dump":
+		dumpCmd := flag.NewFlagSet("config dump", flag.ExitOnError)
+		scope := dumpCmd.String("scope", acme.ScopeConfig, "Scope to dump (e.g. "+acme.ScopeConfig+", "+acme.ScopeAcmeCertificate+")")
+		gen := dumpCmd.Int("gen", 0, "Generation to dump (0 = latest)")
+		output := dumpCmd.String("o", "", "Write to this file instead of stdout")
+		format := dumpCmd.String("format", "", "Output format: toml, json or yaml (default: the stored format)")
+		redact := dumpCmd.Bool("redact-secrets", true, "Mask API tokens, passwords and private keys")
+		dumpCmd.Parse(args)
+		err = handleConfigDumpCommand(secureStore, *scope, *gen, *output, *format, *redact)
+	case "set":
+		setCmd := flag.NewFlagSet("config set", flag.ExitOnError)
+		file := setCmd.String("file", "", "ACME config file to save")
+		format := setCmd.String("format", "", "Format of the file: toml, json or yaml (default: from the extension)")
+		description := setCmd.String("description", "", "Description of the new version")
+		setCmd.Parse(args)
+		if *file == "" {
+			fmt.Fprintf(os.Stderr, "Error: 'config set' requires -file\n")
+			setCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		err = handleConfigSetCommand(secureStore, *file, *format, *description)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown config subcommand: %s\n", subcommand)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// envFlags are the global flags with an ACME_* environment variable fallback.
+var envFlags = []string{"age-key", "age-recipients", "kms", "db", "scope-prefix", "read-only", "busy-timeout", "pool-size", "log-format", "log-level", "quiet", "debug", "systemd-creds", "config-gen", "output"}
+
+// commandWrites reports whether the command modifies the database. All other
+// commands open it read-only so they never contend with the application.
+func commandWrites(command, subcommand string) bool {
+	switch command {
+	case "renew", "prune", "generate-selfsigned", "selftest":
+		return true
+	case "cert":
+		return subcommand == "import" || subcommand == "revoke" || subcommand == "rollback"
+	case "config":
+		return subcommand == "set"
+	default:
+		return false
+	}
+}
+
+// defaultThresholdDays is the default of the -days flags.
+var defaultThresholdDays = int(acme.DefaultRenewalThreshold.Hours() / 24)
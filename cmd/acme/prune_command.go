@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caasmo/restinpieces/db"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+type pruneCandidate struct {
+	id          int64
+	scope       string
+	createdAt   string
+	description string
+}
+
+// handlePruneCommand deletes the versions of scopes beyond the newest keep,
+// restricted to versions created before now-olderThan when olderThan is set.
+func handlePruneCommand(pool *sqlitex.Pool, scopes []string, keep int, olderThan time.Duration, dryRun bool) error {
+	if keep < 1 {
+		return withExitCode(exitUsage, fmt.Errorf("-keep must be at least 1 so the current version is never removed"))
+	}
+
+	conn, err := pool.Take(context.Background())
+	if err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("failed to get db connection for prune command: %w", err))
+	}
+	defer pool.Put(conn)
+
+	cutoff := ""
+	if olderThan > 0 {
+		cutoff = db.TimeFormat(time.Now().Add(-olderThan))
+	}
+
+	var candidates []pruneCandidate
+	for _, scope := range scopes {
+		err := sqlitex.Execute(conn,
+			`SELECT id, scope, created_at, description FROM app_config
+			 WHERE scope = ?
+			 ORDER BY created_at DESC
+			 LIMIT -1 OFFSET ?`,
+			&sqlitex.ExecOptions{
+				Args: []any{scope, keep},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					createdAt := stmt.GetText("created_at")
+					if cutoff != "" && createdAt >= cutoff {
+						return nil
+					}
+					candidates = append(candidates, pruneCandidate{
+						id:          stmt.GetInt64("id"),
+						scope:       stmt.GetText("scope"),
+						createdAt:   createdAt,
+						description: stmt.GetText("description"),
+					})
+					return nil
+				},
+			})
+		if err != nil {
+			return withExitCode(exitStorage, fmt.Errorf("failed to select prune candidates for scope '%s': %w", scope, err))
+		}
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("Nothing to prune.")
+		return nil
+	}
+
+	action := "Deleting"
+	if dryRun {
+		action = "Would delete"
+	}
+	for _, c := range candidates {
+		fmt.Printf("%s id %d  %-16s  %s  %s\n", action, c.id, c.scope, c.createdAt, c.description)
+	}
+	if dryRun {
+		fmt.Printf("%d version(s) would be removed (dry run).\n", len(candidates))
+		return nil
+	}
+
+	if err := deleteConfigRows(conn, candidates); err != nil {
+		return withExitCode(exitStorage, err)
+	}
+	fmt.Printf("Removed %d version(s).\n", len(candidates))
+	return nil
+}
+
+// deleteConfigRows removes the candidates in one transaction so a failure
+// leaves the history untouched.
+func deleteConfigRows(conn *sqlite.Conn, candidates []pruneCandidate) (err error) {
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return fmt.Errorf("failed to begin prune transaction: %w", err)
+	}
+	defer endFn(&err)
+
+	for _, c := range candidates {
+		err = sqlitex.Execute(conn, "DELETE FROM app_config WHERE id = ?", &sqlitex.ExecOptions{Args: []any{c.id}})
+		if err != nil {
+			return fmt.Errorf("failed to delete id %d: %w", c.id, err)
+		}
+	}
+	return nil
+}
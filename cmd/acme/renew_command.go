@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+)
+
+// renewTimeout bounds a complete renewal, including DNS propagation.
+const renewTimeout = 15 * time.Minute
+
+type renewOptions struct {
+	identifier string
+	domain     string
+	// cron checks the stored certificate first and skips the renewal unless
+	// it is due.
+	cron bool
+	// threshold overrides the RenewalThreshold of the config if set.
+	threshold time.Duration
+	// daemon keeps running, re-checking every interval.
+	daemon   bool
+	interval time.Duration
+}
+
+// handleRenewCommand obtains a new certificate, once or, in daemon mode,
+// whenever the stored one becomes due.
+func handleRenewCommand(secureStore config.SecureStore, certStore *acme.SecureCertStore, opts renewOptions, logger *slog.Logger) error {
+	if !opts.daemon {
+		cfg, err := loadAcmeConfig(secureStore)
+		if err != nil {
+			return err
+		}
+		return renewOnce(cfg, secureStore, certStore, opts, logger)
+	}
+	return runRenewDaemon(secureStore, certStore, opts, logger)
+}
+
+// runRenewDaemon re-checks the certificate every interval until SIGINT or
+// SIGTERM. The config is reloaded on each check so a newly saved version
+// takes effect without a restart. A renewal in progress is completed before
+// exiting.
+func runRenewDaemon(secureStore config.SecureStore, certStore *acme.SecureCertStore, opts renewOptions, logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// The daemon only renews when due.
+	opts.cron = true
+	threshold := "RenewalThreshold of the config"
+	if opts.threshold > 0 {
+		threshold = opts.threshold.String()
+	}
+	logger.Info("Starting renewal daemon", "interval", opts.interval, "threshold", threshold)
+
+	var current []byte
+	for {
+		cfg, err := loadAcmeConfig(secureStore)
+		if err != nil {
+			logger.Error("Failed to load ACME config, keeping previous schedule", "error", err)
+		} else {
+			if raw, err := acme.MarshalConfig(cfg); err == nil {
+				if current != nil && !bytes.Equal(current, raw) {
+					logger.Info("New ACME config version loaded", "scope", acme.ScopeConfig, "domains", cfg.Domains)
+				}
+				current = raw
+			}
+			if err := renewOnce(cfg, secureStore, certStore, opts, logger); err != nil {
+				logger.Error("Renewal check failed, retrying at next interval", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Received shutdown signal, stopping renewal daemon")
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+func renewOnce(cfg *acme.Config, secureStore config.SecureStore, certStore *acme.SecureCertStore, opts renewOptions, logger *slog.Logger) error {
+	if len(cfg.Domains) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("ACME config has no domains"))
+	}
+
+	// The stored certificate is identified by its first domain.
+	if opts.identifier != "" && opts.identifier != cfg.Domains[0] {
+		return withExitCode(exitUsage, fmt.Errorf("no certificate with identifier '%s' in ACME config (configured: '%s')", opts.identifier, cfg.Domains[0]))
+	}
+	if opts.domain != "" && !slices.Contains(cfg.Domains, opts.domain) {
+		return withExitCode(exitUsage, fmt.Errorf("no configured certificate covers domain '%s' (configured: %v)", opts.domain, cfg.Domains))
+	}
+
+	if opts.cron {
+		// A missing or unreadable certificate is due, not an error.
+		stored, err := certStore.ByIdentifier(cfg.Domains[0])
+		if err != nil {
+			logger.Debug("No usable stored certificate", "identifier", cfg.Domains[0], "error", err)
+			stored = nil
+		}
+		threshold := opts.threshold
+		if threshold == 0 {
+			threshold, err = time.ParseDuration(cfg.RenewalThreshold)
+			if err != nil {
+				return withExitCode(exitConfig, fmt.Errorf("invalid RenewalThreshold '%s' in ACME config: %w", cfg.RenewalThreshold, err))
+			}
+		}
+		due, reason := acme.RenewalDue(stored, cfg.Domains, threshold, time.Now())
+		if !due {
+			logger.Info("Renewal not due, nothing to do", "identifier", cfg.Domains[0], "reason", reason)
+			return nil
+		}
+		logger.Info("Renewal due", "identifier", cfg.Domains[0], "reason", reason)
+	}
+
+	renewalHandler, err := acme.NewCertRenewalHandler(cfg, secureStore, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), renewTimeout)
+	defer cancel()
+
+	logger.Info("Executing ACME renewal", "identifier", cfg.Domains[0], "domains", cfg.Domains)
+	if err := renewalHandler.Handle(ctx, db.Job{}); err != nil {
+		return fmt.Errorf("renewal failed: %w", err)
+	}
+
+	logger.Info("Renewal completed, certificate saved", "scope", acme.ScopeAcmeCertificate)
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+)
+
+// handleReportCommand prints the certificate report in format text, json or
+// html.
+func handleReportCommand(secureStore config.SecureStore, thresholdDays int, format string) error {
+	if format != outputText && format != outputJSON && format != "html" {
+		return withExitCode(exitUsage, fmt.Errorf("unknown report format '%s' (want text, json or html)", format))
+	}
+	report, err := acme.BuildExpiryReport(secureStore, time.Duration(thresholdDays)*24*time.Hour, time.Now())
+	if err != nil {
+		return withExitCode(exitStorage, err)
+	}
+
+	switch format {
+	case outputJSON:
+		return writeJSON(report)
+	case "html":
+		return report.WriteHTML(os.Stdout)
+	default:
+		return report.WriteText(os.Stdout)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/caasmo/restinpieces-acme"
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+	"github.com/go-acme/lego/v4/lego"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// selftestScopePrefix is prepended to the acme_* scopes the self-test reads
+// and writes, so it never touches the stored certificates and reports.
+const selftestScopePrefix = "acme_selftest_"
+
+// stagingRootURLs are the roots of the Let's Encrypt staging environment,
+// which are not in the system pool.
+var stagingRootURLs = []string{
+	"https://letsencrypt.org/certs/staging/letsencrypt-stg-root-x1.pem",
+	"https://letsencrypt.org/certs/staging/letsencrypt-stg-root-x2.pem",
+}
+
+// handleSelftestCommand runs a complete renewal for the configured domains
+// against the Let's Encrypt staging environment: account registration, the
+// dns-01 challenges with the active DNS provider, the order and the
+// validated save. No deployment target, hook or notification of the config
+// is used, everything is saved under selftestScopePrefix scopes and those
+// are deleted afterwards unless keep is set.
+func handleSelftestCommand(pool *sqlitex.Pool, secureStore config.SecureStore, rootsFile string, timeout time.Duration, keep bool, logger *slog.Logger) error {
+	cfg, err := loadAcmeConfig(secureStore)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Domains) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("ACME config has no domains"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	roots := "file:" + rootsFile
+	if rootsFile == "" {
+		roots, err = fetchStagingRoots(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to download the Let's Encrypt staging roots (use -roots FILE): %w", err)
+		}
+	}
+	testCfg := &acme.Config{
+		Email:                    cfg.Email,
+		Domains:                  cfg.Domains,
+		DNSProviders:             cfg.DNSProviders,
+		CADirectoryURL:           lego.LEDirectoryStaging,
+		ActiveDNSProvider:        cfg.ActiveDNSProvider,
+		KeyType:                  cfg.KeyType,
+		DNSTimeout:               cfg.DNSTimeout,
+		UserAgent:                cfg.UserAgent,
+		TrustedRoots:             roots,
+		AcmeAccountPrivateKey:    cfg.AcmeAccountPrivateKey,
+		AcmeAccountKeyPassphrase: cfg.AcmeAccountKeyPassphrase,
+	}
+
+	store := acme.NewScopedStore(secureStore, acme.DefaultScopes().WithPrefix(selftestScopePrefix))
+	if !keep {
+		defer func() {
+			if err := deleteSelftestScopes(pool); err != nil {
+				logger.Error("Failed to delete self-test scopes", "prefix", selftestScopePrefix, "error", err)
+				return
+			}
+			logger.Info("Deleted self-test scopes", "prefix", selftestScopePrefix)
+		}()
+	}
+
+	logger.Info("Running self-test against the Let's Encrypt staging environment", "domains", testCfg.Domains, "provider", testCfg.ActiveDNSProvider)
+	start := time.Now()
+	handler, err := acme.NewCertRenewalHandler(testCfg, store, logger)
+	if err != nil {
+		return err
+	}
+	if err := handler.Handle(ctx, db.Job{}); err != nil {
+		return fmt.Errorf("self-test failed: %w", err)
+	}
+
+	certStore, err := acme.NewSecureCertStore(store, acme.ScopeAcmeCertificate)
+	if err != nil {
+		return err
+	}
+	cert, err := certStore.Latest()
+	if err != nil {
+		return withExitCode(exitStorage, fmt.Errorf("self-test certificate was not saved: %w", err))
+	}
+	fmt.Printf("Self-test passed in %s: staging certificate for %v issued by %s, expiring %s\n",
+		time.Since(start).Round(time.Second), cert.Domains, cert.IssuerCN, cert.ExpiresAt.Format(time.RFC3339))
+	if keep {
+		fmt.Printf("Kept the self-test scopes (%s*)\n", selftestScopePrefix)
+	}
+	return nil
+}
+
+// fetchStagingRoots returns the PEM of stagingRootURLs.
+func fetchStagingRoots(ctx context.Context) (string, error) {
+	var roots []byte
+	for _, url := range stagingRootURLs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		roots = append(roots, body...)
+	}
+	return string(roots), nil
+}
+
+// deleteSelftestScopes removes every version of the self-test scopes.
+func deleteSelftestScopes(pool *sqlitex.Pool) error {
+	conn, err := pool.Take(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get db connection: %w", err)
+	}
+	defer pool.Put(conn)
+	return sqlitex.Execute(conn, "DELETE FROM app_config WHERE substr(scope, 1, ?) = ?", &sqlitex.ExecOptions{
+		Args: []any{len(selftestScopePrefix), selftestScopePrefix},
+	})
+}
@@ -1,27 +1,34 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log/slog" // Import slog
 	"os"
 
 	"github.com/caasmo/restinpieces"
 
 	"github.com/caasmo/restinpieces-acme"
-	"github.com/pelletier/go-toml/v2"
+	dbz "github.com/caasmo/restinpieces/db/zombiezen"
 )
 
-const JobTypeCertRenewal = "certificate_renewal"
+const (
+	JobTypeCertRenewal = "certificate_renewal"
+	JobTypeCertReport  = "certificate_report"
+)
 
 // Pool creation helpers moved to restinpieces package
 
 func main() {
-	// Create a simple slog text logger that outputs to stdout
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-
 	dbPath := flag.String("db", "", "Path to the SQLite DB (used by framework AND acme history)")
 	ageKeyPath := flag.String("age-key", "", "Path to the age identity (private key) file (required)")
+	ageRecipients := flag.String("age-recipients", "", "File of additional age recipients the ACME scopes are also encrypted to")
+	logFormat := flag.String("log-format", acme.LogFormatText, "Log format: text or json")
+	logLevel := flag.String("log-level", "", "Log level: debug, info, warn or error (default info)")
+	quiet := flag.Bool("quiet", false, "Only log warnings and errors")
+	debug := flag.Bool("debug", false, "Log debug messages")
+	configPoll := flag.Duration("config-poll", acme.DefaultConfigPollInterval, "How often to check acme_config for a new version to reload (0 disables)")
+	configGen := flag.Int("config-gen", 0, "Run with this version of acme_config, counting back from the latest (0); pinned versions are not reloaded")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s -db <db-path> -age-key <id-path>\n\n", os.Args[0])
@@ -30,13 +37,29 @@ func main() {
 		flag.PrintDefaults()
 	}
 
+	if err := acme.FlagsFromEnv(flag.CommandLine, "db", "age-key", "age-recipients", "log-format", "log-level", "quiet", "debug", "config-poll", "config-gen"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	flag.Parse()
 
-	if *dbPath == "" || *ageKeyPath == "" {
+	if *dbPath == "" || *ageKeyPath == "" || *configGen < 0 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	level, err := acme.LogLevel(*logLevel, *quiet, *debug)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Create a slog logger that outputs to stdout
+	logger, err := acme.NewLogger(os.Stdout, *logFormat, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// --- Create Database Pool (Shared by framework and ACME history) ---
 	dbPool, err := restinpieces.NewZombiezenPool(*dbPath) // Use dbPath
 	if err != nil {
@@ -64,32 +87,37 @@ func main() {
 	// Re-assign logger to the one provided by the app, as it might have additional context or handlers.
 	logger = app.Logger()
 
-	// --- Load ACME Renewal Config from SecureConfigStore ---
-	logger.Info("Loading ACME configuration from database", "scope", acme.ScopeConfig)
-	encryptedTomlData, format, err := app.ConfigStore().Get(acme.ScopeConfig, 0)
-	if err != nil {
-		logger.Error("failed to load ACME config from DB", "scope", acme.ScopeConfig, "error", err)
-		os.Exit(1)
-	}
-	if len(encryptedTomlData) == 0 {
-		logger.Error("ACME config data loaded from DB is empty", "scope", acme.ScopeConfig)
-		os.Exit(1)
+	// The ACME scopes are written through a store with the additional
+	// recipients; the application config saved by restinpieces is not.
+	acmeStore := app.ConfigStore()
+	if *ageRecipients != "" {
+		dbImpl, err := dbz.New(dbPool)
+		if err != nil {
+			logger.Error("failed to instantiate zombiezen db from pool", "error", err)
+			os.Exit(1)
+		}
+		if acmeStore, err = acme.NewSecureStore(dbImpl, *ageKeyPath, *ageRecipients); err != nil {
+			logger.Error("failed to create secure store with additional recipients", "path", *ageRecipients, "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Check if the format is TOML before unmarshalling
-	if format != "toml" {
-		logger.Error("ACME config data is not in TOML format", "scope", acme.ScopeConfig, "expected_format", "toml", "actual_format", format)
+	// --- Load ACME Renewal Config from SecureConfigStore ---
+	// In its stored format, with env references and overrides, defaults
+	// and validation applied
+	logger.Info("Loading ACME configuration from database", "scope", acme.ScopeConfig, "generation", *configGen)
+	renewalCfg, err := acme.LoadConfigGeneration(acmeStore, *configGen)
+	if err != nil {
+		logger.Error("failed to load ACME config", "scope", acme.ScopeConfig, "generation", *configGen, "error", err)
 		os.Exit(1)
 	}
+	logger.Info("Successfully loaded ACME config", "scope", acme.ScopeConfig)
 
-	var renewalCfg acme.Config // Declare variable to hold the config
-	if err := toml.Unmarshal(encryptedTomlData, &renewalCfg); err != nil {
-		logger.Error("failed to unmarshal ACME TOML config", "scope", acme.ScopeConfig, "error", err)
+	certHandler, err := acme.NewCertRenewalHandler(renewalCfg, acmeStore, logger)
+	if err != nil {
+		logger.Error("Failed to create certificate renewal job handler", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Successfully unmarshalled ACME config", "scope", acme.ScopeConfig)
-
-	certHandler := acme.NewCertRenewalHandler(&renewalCfg, app.ConfigStore(), logger)
 
 	err = srv.AddJobHandler(JobTypeCertRenewal, certHandler)
 	if err != nil {
@@ -98,6 +126,36 @@ func main() {
 	}
 	logger.Info("Registered certificate renewal job handler", "job_type", JobTypeCertRenewal)
 
+	// An older version pinned with -config-gen is kept, not reloaded
+	if *configGen > 0 {
+		if err := certHandler.PinConfig(*configGen); err != nil {
+			logger.Error("Failed to pin ACME config", "generation", *configGen, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// New versions of acme_config are picked up without a restart
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *configPoll > 0 && *configGen == 0 {
+		go certHandler.WatchConfig(watchCtx, *configPoll)
+		logger.Info("Watching ACME config for new versions", "scope", acme.ScopeConfig, "interval", *configPoll)
+	}
+
+	if len(renewalCfg.ExpiryReport.To) > 0 {
+		reportHandler, err := acme.NewReportHandler(renewalCfg, acmeStore, logger)
+		if err != nil {
+			logger.Error("Failed to create certificate report job handler", "error", err)
+			os.Exit(1)
+		}
+		err = srv.AddJobHandler(JobTypeCertReport, reportHandler)
+		if err != nil {
+			logger.Error("Failed to register certificate report job handler", "job_type", JobTypeCertReport, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Registered certificate report job handler", "job_type", JobTypeCertReport)
+	}
+
 	srv.Run()
 
 	logger.Info("Server shut down gracefully.")
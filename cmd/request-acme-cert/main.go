@@ -4,112 +4,93 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log/slog"
 	"os"
 	"time"
 
-	"github.com/caasmo/restinpieces"
 	"github.com/caasmo/restinpieces-acme"
-	"github.com/caasmo/restinpieces/config"
-	db "github.com/caasmo/restinpieces/db"
+	"github.com/caasmo/restinpieces/db"
 	dbz "github.com/caasmo/restinpieces/db/zombiezen"
-	"github.com/pelletier/go-toml/v2"
 )
 
+// request-acme-cert runs one renewal outside the job runner. It is kept for
+// existing scripts; `acme renew` does the same with more options.
 func main() {
-	logLevel := slog.LevelInfo
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		logLevel = slog.LevelDebug
-	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
-	slog.SetDefault(logger) // Set globally for libraries that might use slog's default
-
-	logger.Info("Starting ACME certificate renewal runner...")
-
-	// --- Flags ---
-	dbPath := flag.String("dbpath", "app.db", "path to SQLite database file")
-	ageKeyPath := flag.String("age-key", "", "Path to the age identity (private key) file (required)")
+	dbPathFlag := flag.String("db", "", "Path to the SQLite database file (required)")
+	flag.StringVar(dbPathFlag, "dbpath", "", "Deprecated alias of -db")
+	ageIdentityPathFlag := flag.String("age-key", "", "Path to the age identity file (private key 'AGE-SECRET-KEY-1...') (required)")
+	logFormatFlag := flag.String("log-format", acme.LogFormatText, "Log format: text or json")
+	logLevelFlag := flag.String("log-level", "", "Log level: debug, info, warn or error (default info)")
+	timeoutFlag := flag.Duration("timeout", 15*time.Minute, "How long the renewal may take")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s -dbpath <db-path> -age-key <id-path>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Runs the ACME certificate renewal process using config from the database.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s -db <db-path> -age-key <id-path>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Runs the ACME certificate renewal process using config from the database.\n")
+		fmt.Fprintf(os.Stderr, "Equivalent to 'acme renew', which also filters by identifier or domain.\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
 	}
 
+	if err := acme.FlagsFromEnv(flag.CommandLine, "db", "age-key", "log-format", "log-level"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	flag.Parse()
 
-	if *dbPath == "" || *ageKeyPath == "" {
+	if *dbPathFlag == "" || *ageIdentityPathFlag == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// --- Database Connection ---
-	logger.Info("Connecting to database pool...", "path", *dbPath)
-	pool, err := restinpieces.NewZombiezenPool(*dbPath)
+	logLevel, err := acme.LogLevel(*logLevelFlag, false, os.Getenv("LOG_LEVEL") == "debug")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	logger, err := acme.NewLogger(os.Stdout, *logFormatFlag, logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	pool, err := acme.NewPool(*dbPathFlag, acme.PoolConfig{})
 	if err != nil {
-		logger.Error("Failed to open database pool", "path", *dbPath, "error", err)
+		logger.Error("failed to create database pool", "db_path", *dbPathFlag, "error", err)
 		os.Exit(1)
 	}
 	defer func() {
-		logger.Info("Closing database pool...")
 		if err := pool.Close(); err != nil {
-			logger.Error("Failed to close database pool", "error", err)
+			logger.Error("error closing database pool", "error", err)
 		}
 	}()
 
-	// --- Secure Config Store ---
-	dbImpl, err := dbz.New(pool) // Create zombiezen db implementation from pool
+	dbImpl, err := dbz.New(pool)
 	if err != nil {
 		logger.Error("failed to instantiate zombiezen db from pool", "error", err)
 		os.Exit(1)
 	}
-	secureCfgStore, err := config.NewSecureConfigAge(dbImpl, *ageKeyPath, logger)
+	secureStore, err := acme.NewSecureStore(dbImpl, *ageIdentityPathFlag, "")
 	if err != nil {
-		logger.Error("failed to instantiate secure config (age)", "age_key_path", *ageKeyPath, "error", err)
+		logger.Error("failed to instantiate secure store (age)", "age_key_path", *ageIdentityPathFlag, "error", err)
 		os.Exit(1)
 	}
 
-	// --- Load ACME Config from Secure Store ---
-	logger.Info("Loading ACME configuration from database", "scope", acme.ConfigScope)
-	encryptedTomlData, err := secureCfgStore.Latest(acme.ConfigScope)
+	cfg, err := acme.LoadConfig(secureStore)
 	if err != nil {
-		logger.Error("failed to load ACME config from DB", "scope", acme.ConfigScope, "error", err)
-		os.Exit(1)
-	}
-	if len(encryptedTomlData) == 0 {
-		logger.Error("ACME config data loaded from DB is empty", "scope", acme.ConfigScope)
+		logger.Error("failed to load ACME config", "scope", acme.ScopeConfig, "error", err)
 		os.Exit(1)
 	}
-
-	var renewalCfg acme.Config
-	if err := toml.Unmarshal(encryptedTomlData, &renewalCfg); err != nil {
-		logger.Error("failed to unmarshal ACME TOML config", "scope", acme.ConfigScope, "error", err)
+	renewalHandler, err := acme.NewCertRenewalHandler(cfg, secureStore, logger)
+	if err != nil {
+		logger.Error("failed to create certificate renewal handler", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Successfully unmarshalled ACME config", "scope", acme.ConfigScope)
-
-	// --- Handler Instantiation ---
-	renewalHandler := acme.NewCertRenewalHandler(&renewalCfg, secureCfgStore, logger)
 
-	// --- Job Execution ---
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
 	defer cancel()
-
-	// Create a dummy job (payload is not used by the acme handler)
-	dummyJob := db.Job{ID: 1}
-
-	logger.Info("Executing ACME Handle method...")
-	os.Exit(1)
-	err = renewalHandler.Handle(ctx, dummyJob)
-
-	// --- Result ---
-	if err != nil {
-		logger.Error("Handler execution failed", "error", err)
+	logger.Info("Executing ACME renewal", "domains", cfg.Domains)
+	if err := renewalHandler.Handle(ctx, db.Job{}); err != nil {
+		logger.Error("Renewal failed", "error", err)
 		os.Exit(1)
 	}
-
-	logger.Info("Handler execution completed successfully.")
-	logger.Info("Certificate should now be saved in the database via SecureConfigStore.", "db_path", *dbPath, "scope", acme.CertificateOutputScope)
-	logger.Info("You can check the database content using sqlite tools or a config dump command.")
+	logger.Info("Certificate saved", "scope", acme.ScopeAcmeCertificate)
 }
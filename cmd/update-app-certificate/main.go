@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/caasmo/restinpieces"
 	"github.com/caasmo/restinpieces-acme"
 	"github.com/caasmo/restinpieces/config"
 	dbz "github.com/caasmo/restinpieces/db/zombiezen"
@@ -14,30 +15,69 @@ import (
 )
 
 func main() {
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-
-	dbPathFlag := flag.String("dbpath", "", "Path to the SQLite database file (required)")
+	dbPathFlag := flag.String("db", "", "Path to the SQLite database file (required)")
+	flag.StringVar(dbPathFlag, "dbpath", "", "Deprecated alias of -db")
 	ageIdentityPathFlag := flag.String("age-key", "", "Path to the age identity file (private key 'AGE-SECRET-KEY-1...') (required)")
+	ageRecipientsFlag := flag.String("age-recipients", "", "File of additional age recipients (age1..., one per line) the saved config is also encrypted to")
+	scopePrefixFlag := flag.String("scope-prefix", "", "Prefix of the acme_* scope names, as given to the acme command")
+	kmsFlag := flag.String("kms", "", "Encrypt with a KMS instead of age: awskms://KEY?region=R, gcpkms://projects/... or vault://MOUNT/KEY (the application config is still saved with -age-key)")
+	busyTimeoutFlag := flag.Duration("busy-timeout", acme.DefaultBusyTimeout, "How long to wait for database locks held by other processes")
+	poolSizeFlag := flag.Int("pool-size", 0, "Number of database connections (0 = one per CPU)")
+	logFormatFlag := flag.String("log-format", acme.LogFormatText, "Log format: text or json")
+	logLevelFlag := flag.String("log-level", "", "Log level: debug, info, warn or error (default info)")
+	quietFlag := flag.Bool("quiet", false, "Only log warnings and errors")
+	debugFlag := flag.Bool("debug", false, "Log debug messages")
+	fromDBFlag := flag.Bool("from-db", true, "Read the certificate from the "+acme.ScopeAcmeCertificate+" scope")
+	identifierFlag := flag.String("identifier", "", "With -from-db, use the latest certificate with this identifier (default: latest)")
+	certPathFlag := flag.String("cert", "", "PEM certificate chain file, leaf first (implies -from-db=false)")
+	keyPathFlag := flag.String("key", "", "PEM private key file (implies -from-db=false)")
+	dryRunFlag := flag.Bool("dry-run", false, "Show which certificate fields would change without saving")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s -dbpath <db-file> -age-key <identity-file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s -db <db-file> -age-key <identity-file> [-identifier ID | -cert <file> -key <file>]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Updates the main application configuration with the latest certificate data from the secure store.\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
 
+	if err := acme.FlagsFromEnv(flag.CommandLine, "db", "age-key", "age-recipients", "scope-prefix", "kms", "busy-timeout", "pool-size", "log-format", "log-level", "quiet", "debug"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	flag.Parse()
 
-	if *dbPathFlag == "" || *ageIdentityPathFlag == "" {
+	if *dbPathFlag == "" || (*ageIdentityPathFlag == "" && *kmsFlag == "") {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if *certPathFlag != "" || *keyPathFlag != "" {
+		fromDBSet := false
+		flag.Visit(func(f *flag.Flag) { fromDBSet = fromDBSet || f.Name == "from-db" })
+		if (fromDBSet && *fromDBFlag) || *certPathFlag == "" || *keyPathFlag == "" {
+			fmt.Fprintf(os.Stderr, "Error: -cert and -key must be given together and exclude -from-db\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		*fromDBFlag = false
+	}
+
+	logLevel, err := acme.LogLevel(*logLevelFlag, *quietFlag, *debugFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	logger, err := acme.NewLogger(os.Stderr, *logFormatFlag, logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// --- Database Setup ---
 	logger.Info("Creating sqlite database pool", "path", *dbPathFlag)
-	pool, err := restinpieces.NewZombiezenPool(*dbPathFlag)
+	pool, err := acme.NewPool(*dbPathFlag, acme.PoolConfig{
+		BusyTimeout: *busyTimeoutFlag,
+		PoolSize:    *poolSizeFlag,
+	})
 	if err != nil {
 		logger.Error("failed to create database pool", "db_path", *dbPathFlag, "error", err)
 		os.Exit(1)
@@ -55,80 +95,185 @@ func main() {
 		os.Exit(1)
 	}
 
-	// --- Instantiate SecureConfig ---
-	secureCfg, err := config.NewSecureConfigAge(dbImpl, *ageIdentityPathFlag, logger)
-	if err != nil {
-		logger.Error("failed to instantiate secure config (age)", "age_key_path", *ageIdentityPathFlag, "error", err)
-		os.Exit(1)
+	var secureStore config.SecureStore
+	if *ageIdentityPathFlag != "" {
+		secureStore, err = acme.NewSecureStore(dbImpl, *ageIdentityPathFlag, *ageRecipientsFlag)
+		if err != nil {
+			logger.Error("failed to instantiate secure store (age)", "age_key_path", *ageIdentityPathFlag, "error", err)
+			os.Exit(1)
+		}
 	}
-
-	// --- Load Latest Certificate Data ---
-	logger.Info("Loading latest certificate data", "scope", acme.ScopeAcmeCertificate)
-	certTomlData, err := secureCfg.Latest(acme.ScopeAcmeCertificate)
-	if err != nil {
-		logger.Error("failed to load certificate data from secure store", "scope", acme.ScopeAcmeCertificate, "error", err)
-		os.Exit(1)
+	scopes := acme.DefaultScopes().WithPrefix(*scopePrefixFlag)
+	if *kmsFlag != "" {
+		secureStore, err = acme.NewKMSSecureStore(dbImpl, *kmsFlag, secureStore, scopes)
+		if err != nil {
+			logger.Error("failed to instantiate secure store (kms)", "kms", *kmsFlag, "error", err)
+			os.Exit(1)
+		}
 	}
-	if len(certTomlData) == 0 {
-		logger.Error("no certificate data found in secure store", "scope", acme.ScopeAcmeCertificate)
-		os.Exit(1)
+	if *scopePrefixFlag != "" {
+		secureStore = acme.NewScopedStore(secureStore, scopes)
 	}
 
-	var certData acme.Cert
-	if err := toml.Unmarshal(certTomlData, &certData); err != nil {
-		logger.Error("failed to unmarshal certificate TOML data", "scope", acme.ScopeAcmeCertificate, "error", err)
+	// --- Load Certificate Data ---
+	var certData *acme.Cert
+	if *fromDBFlag {
+		certData, err = loadCertFromDB(secureStore, *identifierFlag, logger)
+	} else {
+		certData, err = loadCertFromFiles(*certPathFlag, *keyPathFlag, logger)
+	}
+	if err != nil {
+		logger.Error("failed to load certificate", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Successfully loaded and unmarshalled certificate data",
-		"scope", acme.ScopeAcmeCertificate,
+	logger.Info("Successfully loaded certificate data",
 		"identifier", certData.Identifier,
 		"domains", certData.Domains,
 		"issued_at", certData.IssuedAt,
 		"expires_at", certData.ExpiresAt,
 	)
 
-	// --- Load Latest Application Config ---
-	logger.Info("Loading latest application configuration", "scope", config.ScopeApplication)
-	appTomlData, err := secureCfg.Latest(config.ScopeApplication)
-	if err != nil {
-		logger.Error("failed to load application config from secure store", "scope", config.ScopeApplication, "error", err)
-		os.Exit(1)
+	if *dryRunFlag {
+		appCfg, err := loadAppConfig(secureStore)
+		if err != nil {
+			logger.Error("failed to load application config", "scope", config.ScopeApplication, "error", err)
+			os.Exit(1)
+		}
+		printCertDiff(appCfg.Server.CertData, appCfg.Server.KeyData, certData)
+		logger.Info("Dry run, application configuration not saved")
+		return
 	}
-	if len(appTomlData) == 0 {
-		// This might be okay if it's the very first time, but usually an app config should exist.
-		logger.Warn("no existing application configuration found in secure store", "scope", config.ScopeApplication)
-		// Decide if this is an error or if we should proceed with a default/empty config
-		// For now, let's treat it as an error, assuming an app config should exist to be updated.
+
+	logger.Info("Saving updated application configuration", "scope", config.ScopeApplication)
+	if err := acme.UpdateAppConfig(secureStore, certData); err != nil {
+		logger.Error("failed to update application config", "scope", config.ScopeApplication, "error", err)
 		os.Exit(1)
 	}
 
-	var appCfg config.Config
-	if err := toml.Unmarshal(appTomlData, &appCfg); err != nil {
-		logger.Error("failed to unmarshal application config TOML data", "scope", config.ScopeApplication, "error", err)
-		os.Exit(1)
+	logger.Info("Successfully updated application configuration with latest certificate data.")
+}
+
+// loadCertFromDB returns the latest certificate of the acme_certificate
+// scope, or the latest with identifier. Revoked certificates are refused.
+func loadCertFromDB(secureStore config.SecureStore, identifier string, logger *slog.Logger) (*acme.Cert, error) {
+	certStore, err := acme.NewSecureCertStore(secureStore, acme.ScopeAcmeCertificate)
+	if err != nil {
+		return nil, err
 	}
-	logger.Info("Successfully loaded and unmarshalled application configuration", "scope", config.ScopeApplication)
+	logger.Info("Loading certificate data", "scope", certStore.Scope(), "identifier", identifier)
 
-	// --- Update Application Config with Cert Data ---
-	logger.Info("Updating application config with certificate data")
-	appCfg.Server.CertData = certData.CertificateChain
-	appCfg.Server.KeyData = certData.PrivateKey
+	var c *acme.Cert
+	if identifier != "" {
+		c, err = certStore.ByIdentifier(identifier)
+	} else {
+		c, err = certStore.Latest()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.RevokedAt.IsZero() {
+		return nil, fmt.Errorf("certificate '%s' was revoked at %s", c.Identifier, c.RevokedAt.Format(time.RFC3339))
+	}
+	return c, nil
+}
 
-	// --- Marshal Updated Application Config ---
-	updatedAppTomlBytes, err := toml.Marshal(appCfg)
+// loadCertFromFiles reads a PEM chain and key, checking that they match.
+func loadCertFromFiles(certPath, keyPath string, logger *slog.Logger) (*acme.Cert, error) {
+	logger.Info("Loading certificate data from files", "cert", certPath, "key", keyPath)
+	chainPEM, err := os.ReadFile(certPath)
 	if err != nil {
-		logger.Error("failed to marshal updated application config to TOML", "error", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to read certificate file '%s': %w", certPath, err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file '%s': %w", keyPath, err)
+	}
+	defer acme.Zeroize(keyPEM)
+	c, err := acme.NewCert("", nil, chainPEM, keyPEM)
+	if err != nil {
+		return nil, err
 	}
+	if err := c.KeyMatchesLeaf(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	// --- Save Updated Application Config ---
-	description := fmt.Sprintf("Updated TLS cert/key data from certificate store (identifier: %s)", certData.Identifier)
-	logger.Info("Saving updated application configuration", "scope", config.ScopeApplication)
-	err = secureCfg.Save(config.ScopeApplication, updatedAppTomlBytes, "toml", description)
+// loadAppConfig reads the latest application config.
+func loadAppConfig(secureStore config.SecureStore) (*config.Config, error) {
+	data, _, err := secureStore.Get(config.ScopeApplication, 0)
 	if err != nil {
-		logger.Error("failed to save updated application config via SecureConfig", "scope", config.ScopeApplication, "error", err)
-		os.Exit(1)
+		return nil, err
 	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no application config found in scope '%s'", config.ScopeApplication)
+	}
+	defer acme.Zeroize(data)
+	var appCfg config.Config
+	if err := toml.Unmarshal(data, &appCfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal application config TOML data: %w", err)
+	}
+	return &appCfg, nil
+}
 
-	logger.Info("Successfully updated application configuration with latest certificate data.")
+// printCertDiff prints the server certificate fields that an update would
+// change. Private keys are only compared, never printed.
+func printCertDiff(oldCertPEM, oldKeyPEM string, c *acme.Cert) {
+	old := certFields(oldCertPEM)
+	updated := certFields(c.CertificateChain)
+
+	keyChange := "unchanged"
+	switch {
+	case oldKeyPEM == "":
+		keyChange = "(none) -> set"
+	case oldKeyPEM != c.PrivateKey:
+		keyChange = "changed"
+	}
+
+	fmt.Printf("%-10s %-40s %s\n", "Field", "Current", "New")
+	changes := 0
+	for _, name := range []string{"Subject", "SANs", "Issuer", "Serial", "NotBefore", "NotAfter"} {
+		marker := " "
+		if old[name] != updated[name] {
+			marker = "*"
+			changes++
+		}
+		fmt.Printf("%s%-9s %-40s %s\n", marker, name, old[name], updated[name])
+	}
+	fmt.Printf("%-10s %s\n", " Key", keyChange)
+	if keyChange != "unchanged" {
+		changes++
+	}
+
+	if changes == 0 {
+		fmt.Println("No changes: the application already serves this certificate.")
+	} else {
+		fmt.Printf("%d field(s) would change.\n", changes)
+	}
+}
+
+// certFields summarizes the leaf of a PEM chain. An empty or unparsable
+// chain yields placeholder values.
+func certFields(chainPEM string) map[string]string {
+	placeholder := "(none)"
+	if chainPEM != "" {
+		placeholder = "(unparsable)"
+	}
+	fields := map[string]string{}
+	for _, name := range []string{"Subject", "SANs", "Issuer", "Serial", "NotBefore", "NotAfter"} {
+		fields[name] = placeholder
+	}
+
+	chain, err := (&acme.Cert{CertificateChain: chainPEM}).ParseChain()
+	if err != nil {
+		return fields
+	}
+	leaf := chain[0]
+	fields["Subject"] = leaf.Subject.String()
+	fields["SANs"] = strings.Join(leaf.DNSNames, ",")
+	fields["Issuer"] = leaf.Issuer.String()
+	fields["Serial"] = fmt.Sprintf("%x", leaf.SerialNumber)
+	fields["NotBefore"] = leaf.NotBefore.UTC().Format(time.RFC3339)
+	fields["NotAfter"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	return fields
 }
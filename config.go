@@ -0,0 +1,371 @@
+package acme
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/lego"
+)
+
+// DNSProvider holds the credentials of one DNS provider. Only the fields used
+// by that provider need to be set.
+type DNSProvider struct {
+	APIToken string `toml:",omitempty"` // cloudflare; may be a "file:/path" reference (see ReadSecret)
+
+	// route53. Without static keys the AWS default credential chain
+	// (environment, shared config, instance role) is used.
+	AccessKeyID     string `toml:",omitempty"`
+	SecretAccessKey string `toml:",omitempty"`
+	Region          string `toml:",omitempty"`
+	HostedZoneID    string `toml:",omitempty"`
+
+	// Any credential by name, for providers needing more than the fields
+	// above, e.g. Credentials = { APIToken = "..." }. The fields take
+	// precedence over entries of the same name. Every value may be a
+	// "file:/path" reference.
+	Credentials map[string]string `toml:",omitempty"`
+}
+
+// Credential returns the credential name of p: the field of that name if
+// set, else its Credentials entry.
+func (p DNSProvider) Credential(name string) string {
+	if v := p.fields()[name]; v != "" {
+		return v
+	}
+	return p.Credentials[name]
+}
+
+// resolvedCredentials returns every credential of p by name, the fields
+// merged into Credentials, with "file:" references read (see ReadSecret).
+func (p DNSProvider) resolvedCredentials() (map[string]string, error) {
+	creds := make(map[string]string, len(p.Credentials)+5)
+	for name, value := range p.Credentials {
+		creds[name] = value
+	}
+	for name, value := range p.fields() {
+		if value != "" {
+			creds[name] = value
+		}
+	}
+	for name, value := range creds {
+		secret, err := ReadSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("credential %s: %w", name, err)
+		}
+		creds[name] = secret
+	}
+	return creds, nil
+}
+
+func (p DNSProvider) fields() map[string]string {
+	return map[string]string{
+		"APIToken":        p.APIToken,
+		"AccessKeyID":     p.AccessKeyID,
+		"SecretAccessKey": p.SecretAccessKey,
+		"Region":          p.Region,
+		"HostedZoneID":    p.HostedZoneID,
+	}
+}
+
+type Config struct {
+	// used by Let's Encrypt (the ACME CA) primarily for notifications. They
+	// will send reminders about certificate expiry and potentially other
+	// important account notices
+	Email string
+	// Obtaining wildcard certificates (e.g., *.example.com) requires using the
+	// dns-01 challenge type. ACME best practices (and Let's Encrypt's policy)
+	// require you to also include the base domain (example.com) in the same
+	// certificate request Domains = ["example.com", "*.example.com"]
+	Domains      []string
+	DNSProviders map[string]DNSProvider // Map provider name (e.g., "cloudflare") to its config
+	// The Let's Encrypt staging environment
+	// (https://acme-staging-v02.api.letsencrypt.org/directory) and the
+	// production environment (https://acme-v02.api.letsencrypt.org/directory)
+	// are completely separate. Separate Accounts: An account registered on the
+	// staging environment (identified by your AcmeAccountPrivateKey) is not
+	// recognized by the production environment, and vice-versa. You need to
+	// register your account key on each environment you interact with
+	// Empty uses the Let's Encrypt production directory (see SetDefaults)
+	CADirectoryURL    string `toml:",omitempty"`
+	ActiveDNSProvider string // Name of the provider key in DNSProviders map to use
+	// Key of the requested certificates: EC256 (default), EC384, RSA2048,
+	// RSA3072, RSA4096 or RSA8192
+	KeyType string `toml:",omitempty"`
+	// Remaining validity below which the certificate is renewed, a Go
+	// duration (default "720h", 30 days)
+	RenewalThreshold string `toml:",omitempty"`
+	// How long to wait for the dns-01 records to propagate, a Go duration
+	// (default "10m")
+	DNSTimeout string `toml:",omitempty"`
+	// Products put before the restinpieces-acme one in the User-Agent of
+	// ACME requests, e.g. "myapp/1.4 (+https://example.com)"
+	UserAgent string `toml:",omitempty"`
+	// "dev" issues from a local development CA instead of the ACME server
+	// (see NewDevCAClient); empty uses ACME
+	IssuanceMode string `toml:",omitempty"`
+	// Where obtained certificates are saved: "securestore" (default), the
+	// acme_certificate scope; "writer", the Writer given to SetWriter; or
+	// "both"
+	Persistence string `toml:",omitempty"`
+	// PEM roots, or a "file:/path" reference, trusted in addition to the
+	// system roots when verifying the chain of an obtained certificate, e.g.
+	// the Let's Encrypt staging roots or those of a private CA
+	TrustedRoots string `toml:",omitempty"`
+	// openssl genpkey -algorithm Ed25519 -out acme_account_ed25519.key
+	// this is account main identifier for acme providers
+	// For toml manual insertion the Multiline Literal String ('''...''') is
+	// the best choice. A "file:/run/secrets/name" reference reads the key from
+	// that file at renewal time instead.
+	// The key has to be available as PEM: lego signs ACME requests with an
+	// in-memory *rsa.PrivateKey or *ecdsa.PrivateKey only, so PKCS#11/HSM
+	// keys behind a crypto.Signer cannot be used as the account key.
+	AcmeAccountPrivateKey string
+	// Passphrase of an encrypted AcmeAccountPrivateKey (see ParseAccountKey),
+	// best given as a ${env:NAME} or "file:/path" reference.
+	AcmeAccountKeyPassphrase string `toml:",omitempty"`
+	// Copy each renewed certificate into Server.CertData/KeyData of the
+	// restinpieces application config, as cmd/update-app-certificate does.
+	UpdateAppConfig bool
+	// PEM files written after each renewal for servers reading from disk
+	OutputFiles OutputFiles
+	// Passphrase protected PKCS#12 bundle written or stored on each renewal
+	PKCS12 PKCS12Output
+	// Remote hosts the certificate is copied to over SSH
+	SSHTargets []SSHTarget
+	// AWS Certificate Manager imports, e.g. for ALB and CloudFront
+	ACMTargets []ACMTarget
+	// Azure Key Vault imports, e.g. for Application Gateway
+	AzureKeyVaultTargets []AzureKeyVaultTarget
+	// Google Cloud Secret Manager secrets receiving new versions
+	GCPSecretTargets []GCPSecretTarget
+	// Docker Swarm services whose certificate secrets are rotated
+	DockerSecretTargets []DockerSecretTarget
+	// HTTPS endpoints the certificate is POSTed to after each renewal
+	Webhooks []Webhook
+	// Command run before the ACME order is started; a failure aborts the
+	// renewal
+	PreHook Hook
+	// Signal or systemd reload of the server once the certificate is deployed
+	Reload Reload
+	// Command run once the renewed certificate is saved and deployed
+	RenewHook Hook
+	// Email sent when a renewal fails, and optionally when it succeeds
+	EmailNotification EmailNotification
+	// PagerDuty/Opsgenie incident when renewals keep failing
+	Alerting Alerting
+	// Dead man's switch URL pinged after every renewal job
+	Heartbeat Heartbeat
+	// Recipients of the certificate report emailed by ReportHandler
+	ExpiryReport ExpiryReportConfig
+	// Minimum number of embedded SCTs required before saving a certificate
+	CertificateTransparency CertificateTransparency
+}
+
+// Defaults applied by SetDefaults.
+const (
+	DefaultCADirectoryURL = lego.LEDirectoryProduction
+	DefaultKeyType        = "EC256"
+	DefaultDNSTimeout     = 10 * time.Minute
+)
+
+// keyTypes maps the KeyType names to the lego key types.
+var keyTypes = map[string]certcrypto.KeyType{
+	"EC256":   certcrypto.EC256,
+	"EC384":   certcrypto.EC384,
+	"RSA2048": certcrypto.RSA2048,
+	"RSA3072": certcrypto.RSA3072,
+	"RSA4096": certcrypto.RSA4096,
+	"RSA8192": certcrypto.RSA8192,
+}
+
+// SetDefaults fills the empty CADirectoryURL, KeyType, RenewalThreshold
+// and DNSTimeout with DefaultCADirectoryURL, DefaultKeyType,
+// DefaultRenewalThreshold and DefaultDNSTimeout, so a config only needs the
+// email, domains, account key and DNS provider. Set values are kept.
+func (c *Config) SetDefaults() {
+	if c.CADirectoryURL == "" {
+		c.CADirectoryURL = DefaultCADirectoryURL
+	}
+	if c.KeyType == "" {
+		c.KeyType = DefaultKeyType
+	}
+	if c.RenewalThreshold == "" {
+		c.RenewalThreshold = formatDuration(DefaultRenewalThreshold)
+	}
+	if c.DNSTimeout == "" {
+		c.DNSTimeout = formatDuration(DefaultDNSTimeout)
+	}
+}
+
+// certKeyType returns the lego key type of KeyType, DefaultKeyType if empty.
+func (c *Config) certKeyType() (certcrypto.KeyType, error) {
+	name := c.KeyType
+	if name == "" {
+		name = DefaultKeyType
+	}
+	keyType, ok := keyTypes[strings.ToUpper(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown KeyType '%s' in ACME config (supported: EC256, EC384, RSA2048, RSA3072, RSA4096, RSA8192)", c.KeyType)
+	}
+	return keyType, nil
+}
+
+// renewalThreshold returns RenewalThreshold, DefaultRenewalThreshold if
+// empty.
+func (c *Config) renewalThreshold() (time.Duration, error) {
+	return parseConfigDuration("RenewalThreshold", c.RenewalThreshold, DefaultRenewalThreshold)
+}
+
+// dnsTimeout returns DNSTimeout, DefaultDNSTimeout if empty.
+func (c *Config) dnsTimeout() (time.Duration, error) {
+	return parseConfigDuration("DNSTimeout", c.DNSTimeout, DefaultDNSTimeout)
+}
+
+func parseConfigDuration(field, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s '%s' in ACME config, want a positive duration like %s", field, value, formatDuration(def))
+	}
+	return d, nil
+}
+
+// formatDuration formats d without the zero minutes and seconds of
+// time.Duration.String, e.g. "720h" and "10m".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// ParseConfig decodes the TOML of the acme_config scope. ${env:NAME}
+// references are left for ResolveEnvRefs and the result is not validated,
+// see Validate.
+func ParseConfig(data []byte) (*Config, error) {
+	return ParseConfigFormat(data, FormatTOML)
+}
+
+// ParseConfigFormat is ParseConfig for a config in format: FormatTOML,
+// FormatJSON or FormatYAML, as stored with the acme_config scope. The keys
+// are the field names of Config in every format.
+func ParseConfigFormat(data []byte, format string) (*Config, error) {
+	var cfg Config
+	if err := Decode(data, format, &cfg); err != nil {
+		return nil, classify(ErrConfigInvalid, fmt.Errorf("failed to unmarshal ACME %s config: %w", strings.ToUpper(format), err))
+	}
+	return &cfg, nil
+}
+
+// Validate returns an error naming the first missing or malformed setting a
+// renewal needs: valid KeyType, durations and Persistence, the domains as
+// hostnames with at most a leading "*." label (IP addresses too in the dev
+// mode), and unless IssuanceMode is dev, a plain email address, an https://
+// CA directory, the account key and an ActiveDNSProvider present in
+// DNSProviders. The error matches ErrConfigInvalid.
+func (c *Config) Validate() error {
+	return classify(ErrConfigInvalid, c.validate())
+}
+
+func (c *Config) validate() error {
+	if len(c.Domains) == 0 {
+		return fmt.Errorf("ACME config has no Domains")
+	}
+	if c.IssuanceMode != "" && c.IssuanceMode != IssuanceModeDev {
+		return fmt.Errorf("unknown IssuanceMode '%s' in ACME config (supported: '%s' or empty)", c.IssuanceMode, IssuanceModeDev)
+	}
+	dev := c.IssuanceMode == IssuanceModeDev
+	if err := c.validatePersistence(); err != nil {
+		return err
+	}
+	if _, err := c.certKeyType(); err != nil {
+		return err
+	}
+	if _, err := c.renewalThreshold(); err != nil {
+		return err
+	}
+	if _, err := c.dnsTimeout(); err != nil {
+		return err
+	}
+	for _, domain := range c.Domains {
+		if net.ParseIP(domain) != nil {
+			if dev {
+				continue
+			}
+			return fmt.Errorf("invalid domain '%s' in ACME config: IP addresses cannot be validated with dns-01", domain)
+		}
+		if err := validateDomain(domain); err != nil {
+			return fmt.Errorf("invalid domain '%s' in ACME config: %w", domain, err)
+		}
+	}
+	if dev {
+		return nil
+	}
+	switch {
+	case c.Email == "":
+		return fmt.Errorf("ACME config has no Email")
+	case c.CADirectoryURL == "":
+		return fmt.Errorf("ACME config has no CADirectoryURL")
+	}
+	if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != c.Email {
+		return fmt.Errorf("invalid Email '%s' in ACME config: expected a plain address such as admin@example.com", c.Email)
+	}
+	if u, err := url.Parse(c.CADirectoryURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid CADirectoryURL '%s' in ACME config: expected an https:// URL", c.CADirectoryURL)
+	}
+	switch {
+	case c.AcmeAccountPrivateKey == "":
+		return fmt.Errorf("ACME config has no AcmeAccountPrivateKey")
+	case c.ActiveDNSProvider == "":
+		return fmt.Errorf("ActiveDNSProvider field is missing or empty in ACME configuration")
+	}
+	if _, ok := c.DNSProviders[c.ActiveDNSProvider]; !ok {
+		return fmt.Errorf("configured ActiveDNSProvider '%s' not found in DNSProviders map", c.ActiveDNSProvider)
+	}
+	return nil
+}
+
+// validateDomain checks that domain is an ASCII hostname: dot separated
+// labels of letters, digits and inner hyphens, at most 63 bytes each and 253
+// in total. A wildcard is only allowed as the whole first label, "*.".
+func validateDomain(domain string) error {
+	name, wildcard := strings.CutPrefix(domain, "*.")
+	if strings.Contains(name, "*") {
+		return fmt.Errorf("a wildcard must be the single leading label '*.'")
+	}
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("hostname must be 1 to 253 characters long")
+	}
+	labels := strings.Split(name, ".")
+	if wildcard && len(labels) < 2 {
+		return fmt.Errorf("a wildcard needs at least two labels after '*.'")
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("label '%s' must be 1 to 63 characters long", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label '%s' starts or ends with a hyphen", label)
+		}
+		for _, r := range label {
+			if r > 127 {
+				return fmt.Errorf("label '%s' is not ASCII; internationalized names must be punycode", label)
+			}
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("label '%s' has the character %q", label, r)
+			}
+		}
+	}
+	return nil
+}
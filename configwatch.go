@@ -0,0 +1,157 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultConfigPollInterval is how often WatchConfig checks the config
+// scope for a new version.
+const DefaultConfigPollInterval = time.Minute
+
+// LoadConfig returns the latest version of the config scope of store, in
+// its stored format, with its ${env:NAME} references resolved, the
+// ApplyEnvOverrides and SetDefaults applied, and validated.
+func LoadConfig(store ConfigReader) (*Config, error) {
+	return LoadConfigGeneration(store, 0)
+}
+
+// LoadConfigGeneration is LoadConfig for an older version of the config
+// scope: generation 0 is the latest, 1 the one before it, and so on. The
+// generations count back from the latest, so saving a new version shifts
+// them by one.
+func LoadConfigGeneration(store ConfigReader, generation int) (*Config, error) {
+	if generation < 0 {
+		return nil, fmt.Errorf("config generation cannot be negative")
+	}
+	data, format, err := store.Get(ScopeConfig, generation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME config from scope '%s' generation %d: %w", ScopeConfig, generation, err)
+	}
+	defer Zeroize(data)
+	return loadConfig(data, format)
+}
+
+func loadConfig(data []byte, format string) (*Config, error) {
+	if len(data) == 0 {
+		return nil, classify(ErrConfigInvalid, fmt.Errorf("ACME config in scope '%s' is empty", ScopeConfig))
+	}
+	cfg, err := ParseConfigFormat(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if err := ResolveEnvRefs(cfg); err != nil {
+		return nil, classify(ErrConfigInvalid, err)
+	}
+	if err := ApplyEnvOverrides(cfg); err != nil {
+		return nil, classify(ErrConfigInvalid, err)
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// liveConfig is the Config a Renewer and its per-run copies share.
+type liveConfig = atomic.Pointer[Config]
+
+// SetConfig replaces the config of h, applying SetDefaults. Renewals
+// already running finish with the config they started with.
+func (h *Renewer) SetConfig(cfg *Config) {
+	cfg.SetDefaults()
+	h.live.Store(cfg)
+}
+
+// Config returns the current config of h.
+func (h *Renewer) Config() *Config {
+	return h.live.Load()
+}
+
+// current returns h bound to the current config: h itself, or a copy if
+// SetConfig replaced it.
+func (h *Renewer) current() *Renewer {
+	cfg := h.live.Load()
+	if cfg == h.config {
+		return h
+	}
+	r := *h
+	r.config = cfg
+	return &r
+}
+
+// PinConfig replaces the config of h with the given generation of the config
+// scope of its store (see LoadConfigGeneration), so a candidate version can
+// be tried, or a known good one kept, before the latest is promoted. A
+// pinned Renewer does not follow new versions: call PinConfig before
+// WatchConfig, which then returns at once.
+func (h *Renewer) PinConfig(generation int) error {
+	cfg, err := LoadConfigGeneration(h.secureConfigStore, generation)
+	if err != nil {
+		return err
+	}
+	h.SetConfig(cfg)
+	h.pinned = true
+	h.logger.Info("Pinned ACME config", "scope", ScopeConfig, "generation", generation, "domains", cfg.Domains)
+	return nil
+}
+
+// WatchConfig polls the config scope of the store of h every interval and
+// swaps in each new version with SetConfig, so domain or DNS provider
+// changes saved while the server runs take effect at the next renewal
+// without a restart. A version that does not load or validate is logged and
+// ignored, keeping the current config. It returns when ctx is done, or at
+// once if PinConfig pinned the config of h.
+func (h *Renewer) WatchConfig(ctx context.Context, interval time.Duration) {
+	if h.pinned {
+		h.logger.Info("ACME config is pinned, not watching for new versions", "scope", ScopeConfig)
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultConfigPollInterval
+	}
+	var last [sha256.Size]byte
+	if data, format, err := h.secureConfigStore.Get(ScopeConfig, 0); err == nil {
+		last = configVersion(data, format)
+		Zeroize(data)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, format, err := h.secureConfigStore.Get(ScopeConfig, 0)
+		if err != nil {
+			h.logger.Error("Failed to poll ACME config", "scope", ScopeConfig, "error", err)
+			continue
+		}
+		version := configVersion(data, format)
+		if version == last {
+			Zeroize(data)
+			continue
+		}
+		last = version
+		cfg, err := loadConfig(data, format)
+		Zeroize(data)
+		if err != nil {
+			h.logger.Error("New ACME config version is invalid, keeping the current one", "scope", ScopeConfig, "error", err)
+			continue
+		}
+		h.SetConfig(cfg)
+		h.logger.Info("Reloaded ACME config", "scope", ScopeConfig, "domains", cfg.Domains, "provider", cfg.ActiveDNSProvider)
+	}
+}
+
+// configVersion identifies a version of the config scope by its content.
+func configVersion(data []byte, format string) [sha256.Size]byte {
+	return sha256.Sum256(bytes.Join([][]byte{[]byte(format), data}, []byte{0}))
+}
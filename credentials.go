@@ -0,0 +1,115 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CredentialsDirectoryEnv is set by systemd to the directory holding the
+// credentials of LoadCredential=/LoadCredentialEncrypted= for the unit.
+const CredentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+
+// Credential names looked up in $CREDENTIALS_DIRECTORY. DNS provider secrets
+// are named "<provider>-api-token", "<provider>-access-key-id" and
+// "<provider>-secret-access-key", e.g. "cloudflare-api-token", and the
+// entries of DNSProvider.Credentials "<provider>-<name>".
+const (
+	CredentialAgeKey      = "age-key"
+	CredentialAccountKey  = "acme-account-key"
+	credentialAPIToken    = "api-token"
+	credentialAccessKeyID = "access-key-id"
+	credentialSecretKey   = "secret-access-key"
+)
+
+// SystemdCredentialPath returns the path of the named credential. It fails
+// if the process was not started with credentials or name was not passed.
+func SystemdCredentialPath(name string) (string, error) {
+	dir := os.Getenv(CredentialsDirectoryEnv)
+	if dir == "" {
+		return "", fmt.Errorf("$%s is not set; start the unit with LoadCredential=%s:...", CredentialsDirectoryEnv, name)
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("systemd credential '%s' not found: %w", name, err)
+	}
+	return path, nil
+}
+
+// ApplySystemdCredentials replaces the secrets of cfg with the systemd
+// credentials present in $CREDENTIALS_DIRECTORY: the ACME account key and,
+// for every configured DNS provider, its API token, AWS keys and Credentials
+// entries. Secrets without a credential keep their stored value, so cfg can
+// keep only the non-secret settings.
+func ApplySystemdCredentials(cfg *Config) error {
+	dir := os.Getenv(CredentialsDirectoryEnv)
+	if dir == "" {
+		return fmt.Errorf("$%s is not set; start the unit with LoadCredential=", CredentialsDirectoryEnv)
+	}
+
+	read := func(name string, trim bool, dst *string) error {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read systemd credential '%s': %w", name, err)
+		}
+		value := string(data)
+		Zeroize(data)
+		if trim {
+			value = strings.TrimSpace(value)
+		}
+		*dst = value
+		return nil
+	}
+
+	if err := read(CredentialAccountKey, false, &cfg.AcmeAccountPrivateKey); err != nil {
+		return err
+	}
+	for name, p := range cfg.DNSProviders {
+		for suffix, dst := range map[string]*string{
+			credentialAPIToken:    &p.APIToken,
+			credentialAccessKeyID: &p.AccessKeyID,
+			credentialSecretKey:   &p.SecretAccessKey,
+		} {
+			if err := read(name+"-"+suffix, true, dst); err != nil {
+				return err
+			}
+		}
+		for key, value := range p.Credentials {
+			if err := read(name+"-"+key, true, &value); err != nil {
+				return err
+			}
+			p.Credentials[key] = value
+		}
+		cfg.DNSProviders[name] = p
+	}
+	return nil
+}
+
+// secretFilePrefix marks a secret config value holding the path of a file
+// with the secret instead of the secret itself.
+const secretFilePrefix = "file:"
+
+// ReadSecret returns value, or for a "file:/run/secrets/name" reference the
+// content of that file without surrounding whitespace. DNSProvider.APIToken,
+// DNSProvider.SecretAccessKey, the DNSProvider.Credentials and
+// AcmeAccountPrivateKey accept such references for Docker and Kubernetes
+// secret mounts; the file is read on every renewal, so a rotated mount is
+// picked up without a restart.
+func ReadSecret(value string) (string, error) {
+	path, ok := strings.CutPrefix(value, secretFilePrefix)
+	if !ok {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file '%s': %w", path, err)
+	}
+	defer Zeroize(data)
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,121 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// oidSCTList is the X.509 extension holding the embedded signed certificate
+// timestamps (RFC 6962, section 3.3).
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// SCT is an embedded signed certificate timestamp: the promise of a
+// Certificate Transparency log to publish the certificate.
+type SCT struct {
+	LogID     string // Base64 encoded SHA-256 of the log's public key
+	Timestamp time.Time
+}
+
+// CertificateTransparency configures the SCT check of obtained
+// certificates. The log IDs of the embedded SCTs are always recorded in
+// Cert.SCTLogIDs; this section only makes them a requirement.
+type CertificateTransparency struct {
+	// Minimum number of SCTs, from distinct logs, the leaf has to embed.
+	// Chrome and Apple require 2 or 3 depending on the lifetime.
+	MinSCTs int
+	// Base64 log IDs (as listed in the log lists of Chrome or Apple) the
+	// SCTs have to come from. Empty accepts any log.
+	KnownLogIDs []string `toml:",omitempty"`
+}
+
+func (t CertificateTransparency) enabled() bool { return t.MinSCTs > 0 }
+
+// check returns an error unless leaf embeds SCTs from at least MinSCTs
+// distinct known logs. The SCT signatures are not verified, which would need
+// the public keys of the logs.
+func (t CertificateTransparency) check(leaf *x509.Certificate) error {
+	scts, err := EmbeddedSCTs(leaf)
+	if err != nil {
+		return err
+	}
+	var logs []string
+	for _, sct := range scts {
+		if len(t.KnownLogIDs) > 0 && !slices.Contains(t.KnownLogIDs, sct.LogID) {
+			continue
+		}
+		if !slices.Contains(logs, sct.LogID) {
+			logs = append(logs, sct.LogID)
+		}
+	}
+	if len(logs) < t.MinSCTs {
+		return fmt.Errorf("leaf certificate embeds SCTs from %d known CT logs, %d required", len(logs), t.MinSCTs)
+	}
+	return nil
+}
+
+// EmbeddedSCTs parses the SCT list extension of cert. It returns nil if the
+// certificate has none, e.g. one from a private CA.
+func EmbeddedSCTs(cert *x509.Certificate) ([]SCT, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			return parseSCTList(ext.Value)
+		}
+	}
+	return nil, nil
+}
+
+// parseSCTList decodes the extension value: an OCTET STRING wrapping a TLS
+// encoded list of length prefixed SCTs, each starting with a version byte,
+// the 32 byte log ID and a millisecond timestamp.
+func parseSCTList(value []byte) ([]SCT, error) {
+	var list []byte
+	if rest, err := asn1.Unmarshal(value, &list); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed SCT list extension")
+	}
+	if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+		return nil, fmt.Errorf("malformed SCT list")
+	}
+	var scts []SCT
+	for rest := list[2:]; len(rest) > 0; {
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("truncated SCT list")
+		}
+		n := int(binary.BigEndian.Uint16(rest))
+		if len(rest) < 2+n {
+			return nil, fmt.Errorf("truncated SCT list")
+		}
+		sct := rest[2 : 2+n]
+		rest = rest[2+n:]
+		if len(sct) < 1+32+8 {
+			return nil, fmt.Errorf("truncated SCT")
+		}
+		if sct[0] != 0 { // v1
+			continue
+		}
+		ms := int64(binary.BigEndian.Uint64(sct[33:41]))
+		scts = append(scts, SCT{
+			LogID:     base64.StdEncoding.EncodeToString(sct[1:33]),
+			Timestamp: time.UnixMilli(ms).UTC(),
+		})
+	}
+	return scts, nil
+}
+
+// sctLogIDs returns the log IDs of the SCTs embedded in leaf, nil if there
+// are none or they do not parse.
+func sctLogIDs(leaf *x509.Certificate) []string {
+	scts, err := EmbeddedSCTs(leaf)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, sct := range scts {
+		ids = append(ids, sct.LogID)
+	}
+	return ids
+}
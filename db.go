@@ -0,0 +1,295 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// Writer persists obtained certificates.
+type Writer interface {
+	AddCert(cert Cert) error
+}
+
+// Reader gives read-only access to stored certificates.
+type Reader interface {
+	// Latest returns the most recently stored certificate.
+	Latest() (*Cert, error)
+	// ByIdentifier returns the most recently stored certificate with the
+	// given identifier.
+	ByIdentifier(identifier string) (*Cert, error)
+	// ExpiringBefore returns, for each identifier, the most recently stored
+	// certificate if it expires before t.
+	ExpiringBefore(t time.Time) ([]Cert, error)
+}
+
+// maxCertGenerations bounds how far back the history of the scope is scanned.
+const maxCertGenerations = 100
+
+// SecureCertStore stores certificates as encrypted TOML blobs in a scope of a
+// SecureStore (ScopeAcmeCertificate by default). It is the single
+// authoritative place where the current certificate lives.
+type SecureCertStore struct {
+	store config.SecureStore
+	scope string
+}
+
+// NewSecureCertStore returns a store writing to scope. An empty scope uses
+// ScopeAcmeCertificate. It fails if store is nil.
+func NewSecureCertStore(store config.SecureStore, scope string) (*SecureCertStore, error) {
+	if store == nil {
+		return nil, fmt.Errorf("NewSecureCertStore: received nil store")
+	}
+	return newSecureCertStore(store, scope), nil
+}
+
+// newSecureCertStore is NewSecureCertStore for a store known to be set.
+func newSecureCertStore(store config.SecureStore, scope string) *SecureCertStore {
+	if scope == "" {
+		scope = ScopeAcmeCertificate
+	}
+	return &SecureCertStore{store: store, scope: scope}
+}
+
+// Scope returns the SecureStore scope the certificates are stored in.
+func (s *SecureCertStore) Scope() string { return s.scope }
+
+// AddCert saves cert as the latest version of the store's scope.
+func (s *SecureCertStore) AddCert(cert Cert) error {
+	expiryStr := cert.ExpiresAt.Format(time.RFC3339)
+	description := fmt.Sprintf("Obtained certificate for domains: %s (expires %s)", strings.Join(cert.Domains, ", "), expiryStr)
+	return s.save(cert, description)
+}
+
+// Rollback restores the certificate that the latest one of identifier
+// replaced, by saving it again as the latest version. It falls back to the
+// newest older certificate of identifier with a different fingerprint, and
+// refuses revoked or expired ones.
+func (s *SecureCertStore) Rollback(identifier string, now time.Time) (restored, replaced *Cert, err error) {
+	err = s.each(func(c *Cert) bool {
+		if c.Identifier != identifier {
+			return true
+		}
+		if replaced == nil {
+			replaced = c
+			return true
+		}
+		if c.leafFingerprint() == replaced.leafFingerprint() || !c.RevokedAt.IsZero() || !c.ExpiresAt.After(now) {
+			return true
+		}
+		if restored == nil {
+			restored = c
+		}
+		// Prefer the recorded predecessor over the newest candidate.
+		if replaced.PreviousFingerprintSHA256 == "" || c.leafFingerprint() == replaced.PreviousFingerprintSHA256 {
+			restored = c
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if replaced == nil {
+		return nil, nil, certNotFound("no certificate with identifier '%s' in scope '%s'", identifier, s.scope)
+	}
+	if restored == nil {
+		return nil, nil, fmt.Errorf("no earlier unrevoked, unexpired certificate with identifier '%s' to roll back to", identifier)
+	}
+
+	restored.PreviousFingerprintSHA256 = replaced.leafFingerprint()
+	description := fmt.Sprintf("Rolled back %s to the certificate expiring %s", identifier, restored.ExpiresAt.Format(time.RFC3339))
+	if err := s.save(*restored, description); err != nil {
+		return nil, nil, err
+	}
+	return restored, replaced, nil
+}
+
+// save stores cert as the latest version of the scope.
+func (s *SecureCertStore) save(cert Cert, description string) error {
+	tomlBytes, err := MarshalCert(cert)
+	if err != nil {
+		return err
+	}
+	defer Zeroize(tomlBytes)
+
+	if err := s.store.Save(s.scope, tomlBytes, "toml", description); err != nil {
+		return fmt.Errorf("failed to save certificate to scope '%s': %w", s.scope, err)
+	}
+	return nil
+}
+
+// Latest implements Reader.
+func (s *SecureCertStore) Latest() (*Cert, error) {
+	return s.get(0)
+}
+
+// ByIdentifier implements Reader.
+func (s *SecureCertStore) ByIdentifier(identifier string) (*Cert, error) {
+	var found *Cert
+	err := s.each(func(c *Cert) bool {
+		if c.Identifier == identifier {
+			found = c
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, certNotFound("no certificate with identifier '%s' in scope '%s'", identifier, s.scope)
+	}
+	return found, nil
+}
+
+// ExpiringBefore implements Reader.
+func (s *SecureCertStore) ExpiringBefore(t time.Time) ([]Cert, error) {
+	seen := make(map[string]bool)
+	var expiring []Cert
+	err := s.each(func(c *Cert) bool {
+		if seen[c.Identifier] {
+			return true
+		}
+		seen[c.Identifier] = true
+		if c.ExpiresAt.Before(t) {
+			expiring = append(expiring, *c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expiring, nil
+}
+
+// Current returns the most recently stored certificate of every identifier,
+// newest first. Identifiers whose latest certificate is revoked are left
+// out.
+func (s *SecureCertStore) Current() ([]Cert, error) {
+	seen := make(map[string]bool)
+	var current []Cert
+	err := s.each(func(c *Cert) bool {
+		if seen[c.Identifier] {
+			return true
+		}
+		seen[c.Identifier] = true
+		if c.RevokedAt.IsZero() {
+			current = append(current, *c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// scopeEmpty reports whether the result of a SecureStore Get is a scope
+// without versions: no data, or, from the age stores, which decrypt the
+// missing row as an empty blob, an age header cut off at its very start.
+func scopeEmpty(data []byte, err error) bool {
+	if err != nil {
+		return errors.Is(err, io.EOF)
+	}
+	return len(data) == 0
+}
+
+// get decrypts and unmarshals one generation of the scope (0 = latest).
+func (s *SecureCertStore) get(generation int) (*Cert, error) {
+	data, format, err := s.store.Get(s.scope, generation)
+	if scopeEmpty(data, err) {
+		return nil, certNotFound("no certificate data in scope '%s' generation %d", s.scope, generation)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate from scope '%s' generation %d: %w", s.scope, generation, err)
+	}
+	defer Zeroize(data)
+	if format != "toml" {
+		return nil, fmt.Errorf("certificate data in scope '%s' is in format '%s', expected 'toml'", s.scope, format)
+	}
+
+	cert, err := UnmarshalCert(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate from scope '%s' generation %d: %w", s.scope, generation, err)
+	}
+	return cert, nil
+}
+
+// each calls fn for every stored generation, newest first, until fn returns
+// false. The SecureStore does not report the number of generations, so the
+// first failing generation after the latest one marks the end of the history.
+// An empty scope has no history.
+func (s *SecureCertStore) each(fn func(c *Cert) bool) error {
+	for gen := 0; gen < maxCertGenerations; gen++ {
+		cert, err := s.get(gen)
+		if err != nil {
+			if gen == 0 && !errors.Is(err, ErrCertNotFound) {
+				return err
+			}
+			return nil
+		}
+		if !fn(cert) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// History returns every stored generation of the scope, newest first.
+func (s *SecureCertStore) History() ([]Cert, error) {
+	var certs []Cert
+	err := s.each(func(c *Cert) bool {
+		certs = append(certs, *c)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// historyCacheTTL is how long the HTTP handlers reuse the history they read,
+// so frequent scrapes and probes do not decrypt every generation each time.
+const historyCacheTTL = time.Minute
+
+// historyCache is the History of a SecureCertStore read at most once per
+// ttl. Failed reads are not cached.
+type historyCache struct {
+	store *SecureCertStore
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	certs  []Cert
+	readAt time.Time
+}
+
+func newHistoryCache(store *SecureCertStore, ttl time.Duration) *historyCache {
+	return &historyCache{store: store, ttl: ttl}
+}
+
+// History returns the cached history, reading it again once it is older
+// than the ttl.
+func (c *historyCache) History() ([]Cert, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.readAt.IsZero() && time.Since(c.readAt) < c.ttl {
+		return c.certs, nil
+	}
+	certs, err := c.store.History()
+	if err != nil {
+		return nil, err
+	}
+	c.certs, c.readAt = certs, time.Now()
+	return certs, nil
+}
+
+// Generation returns one stored generation of the scope (0 = latest).
+func (s *SecureCertStore) Generation(generation int) (*Cert, error) {
+	return s.get(generation)
+}
@@ -0,0 +1,132 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Target names of the steps run after the deployers.
+const (
+	stepReload    = "reload"
+	stepRenewHook = "renew_hook"
+)
+
+// deployer publishes a newly saved certificate to where it is served.
+type deployer interface {
+	name() string
+	deploy(ctx context.Context, cert *Cert) error
+}
+
+// deployers returns the deployment targets enabled in the handler config.
+func (h *Renewer) deployers() []deployer {
+	var ds []deployer
+	if h.config.UpdateAppConfig {
+		ds = append(ds, appConfigDeployer{store: h.secureConfigStore})
+	}
+	if h.config.OutputFiles.enabled() {
+		ds = append(ds, fileDeployer{files: h.config.OutputFiles})
+	}
+	if h.config.PKCS12.enabled() {
+		ds = append(ds, pkcs12Deployer{output: h.config.PKCS12, store: h.secureConfigStore})
+	}
+	for _, t := range h.config.SSHTargets {
+		ds = append(ds, sshDeployer{target: t})
+	}
+	for _, t := range h.config.ACMTargets {
+		ds = append(ds, acmDeployer{target: t, logger: h.logger})
+	}
+	for _, t := range h.config.AzureKeyVaultTargets {
+		ds = append(ds, azureDeployer{target: t})
+	}
+	for _, t := range h.config.GCPSecretTargets {
+		ds = append(ds, gcpDeployer{target: t})
+	}
+	for _, t := range h.config.DockerSecretTargets {
+		ds = append(ds, dockerDeployer{target: t})
+	}
+	for _, w := range h.config.Webhooks {
+		ds = append(ds, webhookDeployer{hook: w})
+	}
+	return ds
+}
+
+// Deploy publishes cert to the deployment targets of the handler config, as
+// after a renewal, e.g. to push a certificate restored by
+// SecureCertStore.Rollback.
+func (h *Renewer) Deploy(ctx context.Context, cert *Cert) error {
+	return h.current().deploy(ctx, cert)
+}
+
+// deploy runs every enabled deployer, continuing past failures so one broken
+// target does not keep the others on the old certificate. The certificate is
+// already stored when this runs. The Reload and then the RenewHook run last,
+// and only if every deployer succeeded, so they never reload a server onto
+// stale files. The outcome of every step is saved as a DeploymentReport.
+func (h *Renewer) deploy(ctx context.Context, cert *Cert) error {
+	report := &DeploymentReport{
+		Identifier:        cert.Identifier,
+		FingerprintSHA256: cert.FingerprintSHA256,
+		ExpiresAt:         cert.ExpiresAt,
+	}
+
+	var errs []error
+	for _, d := range h.deployers() {
+		h.logger.Info("Deploying certificate", "target", d.name(), "identifier", cert.Identifier)
+		err := d.deploy(ctx, cert)
+		report.add(d.name(), err, h.clock.Now())
+		if err != nil {
+			h.logger.Error("Certificate deployment failed", "target", d.name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", d.name(), err))
+			continue
+		}
+		h.logger.Info("Certificate deployed", "target", d.name())
+	}
+
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("certificate saved, but deployment failed: %w", errors.Join(errs...))
+		h.skipFinalSteps(report, true, true)
+	} else {
+		err = h.runFinalSteps(ctx, cert, report)
+	}
+
+	if len(report.Results) > 0 {
+		if saveErr := SaveDeploymentReport(h.secureConfigStore, *report); saveErr != nil {
+			h.logger.Error("Failed to save deployment report", "error", saveErr)
+		}
+	}
+	return err
+}
+
+// runFinalSteps runs the Reload and then the RenewHook, stopping at the
+// first failure.
+func (h *Renewer) runFinalSteps(ctx context.Context, cert *Cert, report *DeploymentReport) error {
+	if h.config.Reload.enabled() {
+		err := h.reload(ctx)
+		report.add(stepReload, err, h.clock.Now())
+		if err != nil {
+			h.logger.Error("Reload failed", "error", err)
+			h.skipFinalSteps(report, false, true)
+			return fmt.Errorf("certificate saved, but reload failed: %w", err)
+		}
+	}
+	if h.config.RenewHook.Command != "" {
+		err := h.runHook(ctx, hookRenew, h.config.RenewHook, cert)
+		report.add(stepRenewHook, err, h.clock.Now())
+		if err != nil {
+			return fmt.Errorf("certificate saved, but %w", err)
+		}
+	}
+	return nil
+}
+
+// skipFinalSteps records the configured Reload and RenewHook as skipped.
+func (h *Renewer) skipFinalSteps(report *DeploymentReport, reload, hook bool) {
+	if reload && h.config.Reload.enabled() {
+		report.skip(stepReload, h.clock.Now())
+	}
+	if hook && h.config.RenewHook.Command != "" {
+		report.skip(stepRenewHook, h.clock.Now())
+	}
+}
@@ -0,0 +1,33 @@
+package acme
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/caasmo/restinpieces/db"
+)
+
+// A deployment failing after the certificate was saved is recorded, but
+// does not fail the job, so the queue does not order it again.
+func TestRenewDeploymentFailureDoesNotFailJob(t *testing.T) {
+	r := newTestRenewer(t, newTestStore(t))
+	r.SetConfig(&Config{
+		Domains:      []string{"example.com"},
+		IssuanceMode: IssuanceModeDev,
+		OutputFiles:  OutputFiles{CertPath: filepath.Join(t.TempDir(), "missing", "cert.pem")},
+	})
+
+	var failed error
+	r.AddObserver(ObserverFuncs{Failure: func(_ context.Context, _ RenewalRun, err error) { failed = err }})
+	result, err := r.Renew(context.Background(), db.Job{})
+	if err != nil {
+		t.Fatalf("Renew() error = %v; want nil", err)
+	}
+	if !result.Renewed || result.DeployError == "" {
+		t.Fatalf("Renew() = %+v; want a renewed certificate with a DeployError", result)
+	}
+	if failed == nil {
+		t.Fatal("observers were not told about the failed deployment")
+	}
+}
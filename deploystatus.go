@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ScopeAcmeDeployments is the scope of the DeploymentReport saved after each
+// renewal with deployment targets.
+const ScopeAcmeDeployments = "acme_deployments"
+
+// DeploymentResult is the outcome of one deployment target, the Reload or
+// the RenewHook.
+type DeploymentResult struct {
+	Target  string
+	At      time.Time // UTC
+	Success bool
+	Skipped bool   `toml:",omitempty"` // not run because an earlier step failed
+	Error   string `toml:",omitempty"`
+}
+
+// DeploymentReport records how a renewed certificate was deployed, so
+// operators can tell a failed issuance from a failed reload.
+type DeploymentReport struct {
+	Identifier        string
+	FingerprintSHA256 string
+	ExpiresAt         time.Time
+	Results           []DeploymentResult
+}
+
+// Failed reports whether any result did not succeed.
+func (r *DeploymentReport) Failed() bool {
+	for _, res := range r.Results {
+		if !res.Success {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DeploymentReport) add(target string, err error, at time.Time) {
+	res := DeploymentResult{Target: target, At: at.UTC(), Success: err == nil}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	r.Results = append(r.Results, res)
+}
+
+func (r *DeploymentReport) skip(target string, at time.Time) {
+	r.Results = append(r.Results, DeploymentResult{Target: target, At: at.UTC(), Skipped: true})
+}
+
+// SaveDeploymentReport saves report as the latest version of
+// ScopeAcmeDeployments.
+func SaveDeploymentReport(store CertSaver, report DeploymentReport) error {
+	data, err := toml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment report: %w", err)
+	}
+	status := "succeeded"
+	if report.Failed() {
+		status = "failed"
+	}
+	description := fmt.Sprintf("Deployment of %s %s (%d targets)", report.Identifier, status, len(report.Results))
+	if err := store.Save(ScopeAcmeDeployments, data, "toml", description); err != nil {
+		return fmt.Errorf("failed to save deployment report to scope '%s': %w", ScopeAcmeDeployments, err)
+	}
+	return nil
+}
+
+// DeploymentHistory returns up to max saved reports, newest first. The
+// SecureStore cannot tell a missing generation from an unreadable one, so the
+// first failing generation after the latest one ends the history; a scope
+// without reports, as before the first deployment, yields none.
+func DeploymentHistory(store ConfigReader, max int) ([]DeploymentReport, error) {
+	var reports []DeploymentReport
+	for gen := 0; gen < max; gen++ {
+		data, format, err := store.Get(ScopeAcmeDeployments, gen)
+		if scopeEmpty(data, err) {
+			break
+		}
+		if err != nil {
+			if gen == 0 {
+				return nil, fmt.Errorf("failed to load deployment report from scope '%s': %w", ScopeAcmeDeployments, err)
+			}
+			break
+		}
+		if format != "toml" {
+			return nil, fmt.Errorf("deployment report in scope '%s' is in format '%s', expected 'toml'", ScopeAcmeDeployments, format)
+		}
+		var report DeploymentReport
+		if err := toml.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal deployment report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,243 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// IssuanceModeDev is the Config.IssuanceMode minting certificates from a
+// local development CA instead of an ACME server.
+const IssuanceModeDev = "dev"
+
+// ScopeAcmeDevCA is the scope holding the DevCA of IssuanceModeDev.
+const ScopeAcmeDevCA = "acme_dev_ca"
+
+const (
+	devCALifetime   = 10 * 365 * 24 * time.Hour
+	devLeafLifetime = 90 * 24 * time.Hour
+)
+
+// DevCA is the self-signed CA of IssuanceModeDev, generated on first use.
+// Add CertificatePEM to the trust store of the development machine, as with
+// minica or mkcert.
+type DevCA struct {
+	CertificatePEM string
+	PrivateKeyPEM  string
+	CreatedAt      time.Time
+}
+
+// LoadDevCA returns the saved DevCA, or nil when none was saved yet. Other
+// failures to read the scope are returned, so a transient error never makes
+// LoadOrCreateDevCA replace the CA.
+func LoadDevCA(store ConfigReader) (*DevCA, error) {
+	data, format, err := store.Get(ScopeAcmeDevCA, 0)
+	if scopeEmpty(data, err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load development CA from scope '%s': %w", ScopeAcmeDevCA, err)
+	}
+	defer Zeroize(data)
+	if format != "toml" {
+		return nil, fmt.Errorf("development CA in scope '%s' is in format '%s', expected 'toml'", ScopeAcmeDevCA, format)
+	}
+	var ca DevCA
+	if err := toml.Unmarshal(data, &ca); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal development CA: %w", err)
+	}
+	return &ca, nil
+}
+
+// LoadOrCreateDevCA returns the saved DevCA, generating and saving a new
+// ECDSA P-256 CA valid for ten years if there is none.
+func LoadOrCreateDevCA(store config.SecureStore) (*DevCA, error) {
+	ca, err := LoadDevCA(store)
+	if err != nil || ca != nil {
+		return ca, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate development CA key: %w", err)
+	}
+	defer zeroizeKey(key)
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "restinpieces-acme development CA " + now.Format("20060102")},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(devCALifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create development CA certificate: %w", err)
+	}
+	keyPEM := certcrypto.PEMEncode(key)
+	defer Zeroize(keyPEM)
+	ca = &DevCA{
+		CertificatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKeyPEM:  string(keyPEM),
+		CreatedAt:      now,
+	}
+
+	data, err := toml.Marshal(ca)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal development CA: %w", err)
+	}
+	defer Zeroize(data)
+	if err := store.Save(ScopeAcmeDevCA, data, "toml", "Local development CA"); err != nil {
+		return nil, fmt.Errorf("failed to save development CA to scope '%s': %w", ScopeAcmeDevCA, err)
+	}
+	return ca, nil
+}
+
+// NewDevCAClient returns an AcmeClient issuing from the DevCA of store,
+// creating it if needed. No ACME server or DNS provider is contacted:
+// Register and Revoke do nothing and every Obtain mints a new ECDSA P-256
+// leaf valid for 90 days, so the certificate goes through the same
+// validation, storage and deployment as one from an ACME CA.
+func NewDevCAClient(store config.SecureStore) (AcmeClient, error) {
+	ca, err := LoadOrCreateDevCA(store)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(ca.CertificatePEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode development CA certificate")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse development CA certificate: %w", err)
+	}
+	caKey, err := certcrypto.ParsePEMPrivateKey([]byte(ca.PrivateKeyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse development CA key: %w", err)
+	}
+	return &devCAClient{cert: caCert, certPEM: []byte(ca.CertificatePEM), key: caKey}, nil
+}
+
+// devCAClient is the AcmeClient of NewDevCAClient.
+type devCAClient struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.PrivateKey
+}
+
+// SetDNS01Provider implements AcmeClient; there are no challenges to solve.
+func (c *devCAClient) SetDNS01Provider(challenge.Provider, ...dns01.ChallengeOption) error {
+	return nil
+}
+
+// Register implements AcmeClient.
+func (c *devCAClient) Register() (string, error) {
+	return "dev:local", nil
+}
+
+// Obtain implements AcmeClient.
+func (c *devCAClient) Obtain(request certificate.ObtainRequest) (*certificate.Resource, error) {
+	if len(request.Domains) == 0 {
+		return nil, fmt.Errorf("no domains to obtain a certificate for")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	defer zeroizeKey(key)
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: request.Domains[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(devLeafLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, domain := range request.Domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, key.Public(), c.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate with the development CA: %w", err)
+	}
+
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &certificate.Resource{
+		Domain:            request.Domains[0],
+		Certificate:       append(leafPEM, c.certPEM...),
+		IssuerCertificate: c.certPEM,
+		PrivateKey:        certcrypto.PEMEncode(key),
+	}, nil
+}
+
+// Revoke implements AcmeClient; development certificates are not revoked.
+func (c *devCAClient) Revoke([]byte, uint) error {
+	return nil
+}
+
+// RenewalInfo implements AcmeClient.
+func (c *devCAClient) RenewalInfo(*x509.Certificate) (*certificate.RenewalInfoResponse, error) {
+	return nil, fmt.Errorf("the development CA does not support renewal information")
+}
+
+// Close implements AcmeClient.
+func (c *devCAClient) Close() {
+	zeroizeKey(c.key)
+}
+
+// rootPool returns the roots obtained certificates are verified against:
+// RootPool of TrustedRoots, plus the DevCA in IssuanceModeDev.
+func (h *Renewer) rootPool() (*x509.CertPool, error) {
+	roots, err := RootPool(h.config.TrustedRoots)
+	if err != nil || h.config.IssuanceMode != IssuanceModeDev {
+		return roots, err
+	}
+	ca, err := LoadDevCA(h.secureConfigStore)
+	if err != nil {
+		return nil, err
+	}
+	if ca != nil {
+		roots.AppendCertsFromPEM([]byte(ca.CertificatePEM))
+	}
+	return roots, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/miekg/dns"
+)
+
+// PublicResolvers are the recursive resolvers CheckDNSProvider queries to
+// confirm a challenge record is publicly visible.
+var PublicResolvers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+const dnsCheckInterval = 5 * time.Second
+
+// CheckDNSProvider verifies the active DNS provider of cfg without placing
+// an ACME order: it presents a throwaway _acme-challenge TXT record for
+// domain, waits until every resolver in PublicResolvers returns it, and
+// removes it again. A wildcard domain is checked at its base name, like the
+// dns-01 challenge itself.
+func CheckDNSProvider(cfg *Config, domain string, timeout time.Duration, logger *slog.Logger) error {
+	provider, err := activeDNSProvider(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	domain = strings.TrimPrefix(domain, "*.")
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate test token: %w", err)
+	}
+	keyAuth := "restinpieces-acme-dns-test." + hex.EncodeToString(token)
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+
+	logger.Info("Creating test TXT record", "provider", cfg.ActiveDNSProvider, "fqdn", info.EffectiveFQDN, "value", info.Value)
+	if err := provider.Present(domain, "", keyAuth); err != nil {
+		return fmt.Errorf("DNS provider '%s' failed to create TXT record %s: %w", cfg.ActiveDNSProvider, info.EffectiveFQDN, err)
+	}
+	defer func() {
+		logger.Info("Removing test TXT record", "fqdn", info.EffectiveFQDN)
+		if err := provider.CleanUp(domain, "", keyAuth); err != nil {
+			logger.Error("Failed to remove test TXT record, remove it manually", "fqdn", info.EffectiveFQDN, "error", err)
+		}
+	}()
+
+	deadline := time.Now().Add(timeout)
+	pending := append([]string(nil), PublicResolvers...)
+	for {
+		var still []string
+		for _, resolver := range pending {
+			found, err := txtRecordVisible(info.EffectiveFQDN, info.Value, resolver)
+			if err != nil {
+				logger.Debug("TXT lookup failed", "resolver", resolver, "error", err)
+			}
+			if found {
+				logger.Info("Test TXT record visible", "resolver", resolver)
+				continue
+			}
+			still = append(still, resolver)
+		}
+		pending = still
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("TXT record %s not visible via %v after %s", info.EffectiveFQDN, pending, timeout)
+		}
+		time.Sleep(dnsCheckInterval)
+	}
+}
+
+// txtRecordVisible reports whether resolver returns value among the TXT
+// records of fqdn.
+func txtRecordVisible(fqdn, value, resolver string) (bool, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+	m.RecursionDesired = true
+
+	client := &dns.Client{Timeout: 10 * time.Second}
+	resp, _, err := client.Exchange(m, resolver)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,239 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDockerHost is the Docker Engine API endpoint used when a
+	// DockerSecretTarget has no Host.
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+
+	// dockerTimeout bounds the API calls of one deployment.
+	dockerTimeout = time.Minute
+)
+
+// DockerSecretTarget rotates the certificate of a Docker Swarm service. Each
+// renewal creates new secrets for the full chain and the key, named
+// "<SecretPrefix>-fullchain-<fingerprint>" and "<SecretPrefix>-key-<fingerprint>",
+// and updates Service to mount them at the same CertFile and KeyFile, which
+// rolls its tasks onto the new certificate. Old secrets are left in place for
+// tasks still running on them and can be removed with `docker secret rm`.
+type DockerSecretTarget struct {
+	Host         string `toml:",omitempty"` // unix:///path or tcp://host:port (default unix:///var/run/docker.sock)
+	Service      string // Service name or ID
+	SecretPrefix string `toml:",omitempty"` // default: the service name
+	CertFile     string `toml:",omitempty"` // Target file name in the container (default "fullchain.pem")
+	KeyFile      string `toml:",omitempty"` // default "privkey.pem"
+}
+
+// dockerDeployer rotates the secrets of one DockerSecretTarget.
+type dockerDeployer struct {
+	target DockerSecretTarget
+}
+
+func (d dockerDeployer) name() string { return "docker_secret:" + d.target.Service }
+
+func (d dockerDeployer) deploy(ctx context.Context, cert *Cert) error {
+	t := d.target
+	if t.Service == "" {
+		return fmt.Errorf("DockerSecretTarget.Service is required")
+	}
+	prefix := t.SecretPrefix
+	if prefix == "" {
+		prefix = t.Service
+	}
+	certFile, keyFile := t.CertFile, t.KeyFile
+	if certFile == "" {
+		certFile = "fullchain.pem"
+	}
+	if keyFile == "" {
+		keyFile = "privkey.pem"
+	}
+
+	client, err := newDockerClient(t.Host)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dockerTimeout)
+	defer cancel()
+
+	suffix := cert.FingerprintSHA256
+	if len(suffix) > 12 {
+		suffix = suffix[:12]
+	}
+	labels := map[string]string{"acme.identifier": cert.Identifier, "acme.expires_at": cert.ExpiresAt.UTC().Format(time.RFC3339)}
+	certSecret, err := client.createSecret(ctx, prefix+"-fullchain-"+suffix, []byte(cert.CertificateChain), labels)
+	if err != nil {
+		return err
+	}
+	keySecret, err := client.createSecret(ctx, prefix+"-key-"+suffix, []byte(cert.PrivateKey), labels)
+	if err != nil {
+		return err
+	}
+
+	// The spec is kept generic so fields unknown to this package survive the
+	// update.
+	var service struct {
+		ID      string
+		Version struct{ Index uint64 }
+		Spec    map[string]any
+	}
+	if err := client.do(ctx, http.MethodGet, "/services/"+url.PathEscape(t.Service), nil, &service); err != nil {
+		return fmt.Errorf("failed to inspect service '%s': %w", t.Service, err)
+	}
+	taskTemplate, _ := service.Spec["TaskTemplate"].(map[string]any)
+	containerSpec, _ := taskTemplate["ContainerSpec"].(map[string]any)
+	if containerSpec == nil {
+		return fmt.Errorf("service '%s' has no container spec", t.Service)
+	}
+
+	var secrets []any
+	existing, _ := containerSpec["Secrets"].([]any)
+	for _, s := range existing {
+		ref, _ := s.(map[string]any)
+		file, _ := ref["File"].(map[string]any)
+		if name, _ := file["Name"].(string); name == certFile || name == keyFile {
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	secrets = append(secrets, secretReference(certSecret, certFile), secretReference(keySecret, keyFile))
+	containerSpec["Secrets"] = secrets
+
+	path := fmt.Sprintf("/services/%s/update?version=%d", url.PathEscape(service.ID), service.Version.Index)
+	if err := client.do(ctx, http.MethodPost, path, service.Spec, nil); err != nil {
+		return fmt.Errorf("failed to update service '%s': %w", t.Service, err)
+	}
+	return nil
+}
+
+// dockerSecret identifies a created secret.
+type dockerSecret struct {
+	ID   string
+	Name string
+}
+
+// secretReference mounts s in the container as /run/secrets/<file>,
+// readable by root only.
+func secretReference(s dockerSecret, file string) map[string]any {
+	return map[string]any{
+		"SecretID":   s.ID,
+		"SecretName": s.Name,
+		"File":       map[string]any{"Name": file, "UID": "0", "GID": "0", "Mode": 0400},
+	}
+}
+
+// dockerClient is a minimal Docker Engine API client.
+type dockerClient struct {
+	http *http.Client
+	base string
+}
+
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = DefaultDockerHost
+	}
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		socket := strings.TrimPrefix(host, "unix://")
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &dockerClient{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case strings.HasPrefix(host, "tcp://"):
+		return &dockerClient{http: http.DefaultClient, base: "http://" + strings.TrimPrefix(host, "tcp://")}, nil
+	default:
+		return nil, fmt.Errorf("unsupported DockerSecretTarget.Host '%s', want unix:// or tcp://", host)
+	}
+}
+
+// createSecret creates a secret, or returns the existing one of that name
+// when the deployment is retried for the same certificate.
+func (c *dockerClient) createSecret(ctx context.Context, name string, data []byte, labels map[string]string) (dockerSecret, error) {
+	var created struct{ ID string }
+	err := c.do(ctx, http.MethodPost, "/secrets/create", map[string]any{"Name": name, "Data": data, "Labels": labels}, &created)
+	if err == nil {
+		return dockerSecret{ID: created.ID, Name: name}, nil
+	}
+	var apiErr *dockerAPIError
+	if !errors.As(err, &apiErr) || apiErr.status != http.StatusConflict {
+		return dockerSecret{}, fmt.Errorf("failed to create secret '%s': %w", name, err)
+	}
+
+	filters, _ := json.Marshal(map[string][]string{"name": {name}})
+	var found []struct {
+		ID   string
+		Spec struct{ Name string }
+	}
+	if err := c.do(ctx, http.MethodGet, "/secrets?filters="+url.QueryEscape(string(filters)), nil, &found); err != nil {
+		return dockerSecret{}, fmt.Errorf("failed to look up existing secret '%s': %w", name, err)
+	}
+	for _, s := range found {
+		if s.Spec.Name == name {
+			return dockerSecret{ID: s.ID, Name: name}, nil
+		}
+	}
+	return dockerSecret{}, fmt.Errorf("secret '%s' exists but could not be found", name)
+}
+
+// dockerAPIError is a non-2xx response of the Docker Engine API.
+type dockerAPIError struct {
+	status  int
+	message string
+}
+
+func (e *dockerAPIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.status, http.StatusText(e.status), e.message)
+}
+
+// do sends in as JSON (if not nil) and decodes the response into out (if
+// not nil).
+func (c *dockerClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct{ Message string }
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &apiErr) != nil {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return &dockerAPIError{status: resp.StatusCode, message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,50 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables overriding the settings of a loaded Config, see
+// ApplyEnvOverrides. They do not collide with the FlagEnvVar of any flag.
+const (
+	EnvEmail             = "ACME_EMAIL"
+	EnvDomains           = "ACME_DOMAINS" // comma separated
+	EnvActiveDNSProvider = "ACME_ACTIVE_DNS_PROVIDER"
+	EnvCADirectoryURL    = "ACME_CA_DIRECTORY_URL"
+	EnvRenewalThreshold  = "ACME_RENEWAL_THRESHOLD"
+	EnvDNSTimeout        = "ACME_DNS_TIMEOUT"
+)
+
+// ApplyEnvOverrides replaces settings of cfg by the Env* variables that are
+// set and not empty, so a container can change the email, domains, active
+// DNS provider, CA directory or thresholds of the stored config without
+// saving a new encrypted version. Apply it after ParseConfig; the result is
+// checked by Validate as usual.
+func ApplyEnvOverrides(cfg *Config) error {
+	for name, field := range map[string]*string{
+		EnvEmail:             &cfg.Email,
+		EnvActiveDNSProvider: &cfg.ActiveDNSProvider,
+		EnvCADirectoryURL:    &cfg.CADirectoryURL,
+		EnvRenewalThreshold:  &cfg.RenewalThreshold,
+		EnvDNSTimeout:        &cfg.DNSTimeout,
+	} {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			*field = value
+		}
+	}
+
+	if value := os.Getenv(EnvDomains); strings.TrimSpace(value) != "" {
+		var domains []string
+		for _, domain := range strings.Split(value, ",") {
+			domain = strings.TrimSpace(domain)
+			if domain == "" {
+				return fmt.Errorf("%s=%q has an empty domain", EnvDomains, value)
+			}
+			domains = append(domains, domain)
+		}
+		cfg.Domains = domains
+	}
+	return nil
+}
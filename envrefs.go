@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+)
+
+// envRefPattern matches ${env:NAME} references in config strings.
+var envRefPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ResolveEnvRefs replaces every ${env:NAME} reference in the string fields
+// of cfg (DNS provider tokens, the account key, hook and target settings,
+// ...) with the value of the environment variable NAME, so the stored TOML
+// can name a secret instead of containing it, e.g.
+//
+//	APIToken = "${env:CLOUDFLARE_API_TOKEN}"
+//
+// Rotating such a secret then only needs a restart, not a new config
+// version. A reference to an unset variable is an error; a variable set to
+// the empty string resolves to it.
+func ResolveEnvRefs(cfg *Config) error {
+	return resolveEnvRefs(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func resolveEnvRefs(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		resolved, err := expandEnvRefs(v.String())
+		if err != nil {
+			return fmt.Errorf("config field %s: %w", path, err)
+		}
+		v.SetString(resolved)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				if err := resolveEnvRefs(v.Field(i), joinFieldPath(path, f.Name)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveEnvRefs(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map values are not addressable: resolve a copy and store it back.
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := resolveEnvRefs(elem, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return resolveEnvRefs(v.Elem(), path)
+		}
+	}
+	return nil
+}
+
+// expandEnvRefs replaces the ${env:NAME} references of s.
+func expandEnvRefs(s string) (string, error) {
+	var missing string
+	resolved := envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s referenced by ${env:%s} is not set", missing, missing)
+	}
+	return resolved, nil
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,98 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+)
+
+// Failure classes of renewals, the config and the certificate store. The
+// errors returned by the handler and SecureCertStore keep their messages but
+// match these with errors.Is, so callers can branch on the class instead of
+// matching strings. Rate limits are reported as *ErrRateLimited.
+var (
+	// The challenge records were not visible to the resolvers in time.
+	ErrDNSPropagationTimeout = errors.New("DNS propagation timed out")
+	// The CA refused to issue for a domain: a failed challenge, a CAA
+	// record or its policy.
+	ErrUnauthorizedDomain = errors.New("CA did not authorize the domain")
+	// No stored certificate matches.
+	ErrCertNotFound = errors.New("certificate not found")
+	// The ACME config does not parse or lacks a required setting.
+	ErrConfigInvalid = errors.New("invalid ACME config")
+)
+
+// ACME problem types (RFC 8555 section 6.7) mapped to failure classes.
+const (
+	problemRateLimited        = "urn:ietf:params:acme:error:rateLimited"
+	problemUnauthorized       = "urn:ietf:params:acme:error:unauthorized"
+	problemCAA                = "urn:ietf:params:acme:error:caa"
+	problemRejectedIdentifier = "urn:ietf:params:acme:error:rejectedIdentifier"
+)
+
+// ErrRateLimited is returned when the CA rate limited the account.
+// RetryAfter is how long to wait before the next order, zero if the CA did
+// not say.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ErrRateLimited) Error() string { return e.Err.Error() }
+func (e *ErrRateLimited) Unwrap() error { return e.Err }
+
+// retryAfterPattern matches the retry time in the problem detail of Let's
+// Encrypt rate limits.
+var retryAfterPattern = regexp.MustCompile(`retry after (\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) UTC`)
+
+// classifiedError is err, matching class too.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string   { return e.err.Error() }
+func (e *classifiedError) Unwrap() []error { return []error{e.err, e.class} }
+
+// classify returns err unchanged in message, matching class with errors.Is.
+func classify(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// classifyObtainError attaches the failure class to an error of
+// AcmeClient.Obtain, returning it unchanged if none applies.
+func classifyObtainError(err error, now time.Time) error {
+	var problem *legoacme.ProblemDetails
+	if errors.As(err, &problem) {
+		switch problem.Type {
+		case problemRateLimited:
+			rateLimited := &ErrRateLimited{Err: err}
+			if m := retryAfterPattern.FindStringSubmatch(problem.Detail); m != nil {
+				if at, perr := time.Parse(time.DateTime, m[1]); perr == nil && at.After(now) {
+					rateLimited.RetryAfter = at.Sub(now)
+				}
+			}
+			return rateLimited
+		case problemUnauthorized, problemCAA, problemRejectedIdentifier:
+			return classify(ErrUnauthorizedDomain, err)
+		}
+	}
+	// lego reports a propagation timeout as "propagation: time limit
+	// exceeded", without an error type.
+	if strings.Contains(err.Error(), "propagation: time limit exceeded") {
+		return classify(ErrDNSPropagationTimeout, err)
+	}
+	return err
+}
+
+// certNotFound returns an ErrCertNotFound error with a formatted message.
+func certNotFound(format string, args ...any) error {
+	return classify(ErrCertNotFound, fmt.Errorf(format, args...))
+}
@@ -0,0 +1,122 @@
+package acme
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+)
+
+// EventType names a step of the renewal lifecycle.
+type EventType string
+
+// Events emitted by CertRenewalHandler.Handle, in the order they occur.
+const (
+	EventRenewalStarted   EventType = "renewal_started"
+	EventDNSRecordCreated EventType = "dns_record_created" // once per challenged domain
+	EventChallengeValid   EventType = "challenge_valid"    // once per domain, after the CA validated every challenge
+	EventCertObtained     EventType = "cert_obtained"
+	EventIssuanceChanged  EventType = "issuance_changed" // lifetime, issuer, intermediates or key type differ from the previous certificate
+	EventCertSaved        EventType = "cert_saved"
+	EventRenewalFailed    EventType = "renewal_failed"
+)
+
+// Event is one renewal lifecycle event. Fields not relevant to the Type are
+// zero.
+type Event struct {
+	Type       EventType
+	At         time.Time // UTC
+	Identifier string    // Identifier of the certificate being renewed
+	Domains    []string  // Configured domains
+	Domain     string    // dns_record_created, challenge_valid
+	CertURL    string    // cert_obtained: certificate URL at the CA
+	Cert       *Cert     // cert_saved: the stored certificate, including its private key
+	Changes    []string  // issuance_changed: what differs from the previous certificate
+	Err        error     // renewal_failed
+}
+
+// EventSink receives the renewal events of a CertRenewalHandler. Emit is
+// called synchronously from the renewal job, so it should return quickly.
+type EventSink interface {
+	Emit(ctx context.Context, event Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(ctx context.Context, event Event)
+
+// Emit calls f(ctx, event).
+func (f EventSinkFunc) Emit(ctx context.Context, event Event) { f(ctx, event) }
+
+// SetEventSink makes the handler emit its renewal events to sink. A nil sink
+// disables events.
+func (h *Renewer) SetEventSink(sink EventSink) {
+	h.events = sink
+}
+
+// emit sends an event of type t, filled in by fill, to the event sink.
+func (h *Renewer) emit(ctx context.Context, t EventType, identifier string, fill func(e *Event)) {
+	if h.events == nil {
+		return
+	}
+	e := Event{
+		Type:       t,
+		At:         h.clock.Now().UTC(),
+		Identifier: identifier,
+		Domains:    h.config.Domains,
+	}
+	if fill != nil {
+		fill(&e)
+	}
+	h.events.Emit(ctx, e)
+}
+
+// observeProvider wraps provider so every presented challenge record emits
+// EventDNSRecordCreated and every cleanup is recorded in timer.
+func (h *Renewer) observeProvider(ctx context.Context, provider challenge.Provider, identifier string, timer *phaseTimer) challenge.Provider {
+	p := eventProvider{
+		Provider: provider,
+		created: func(domain string) {
+			h.emit(ctx, EventDNSRecordCreated, identifier, func(e *Event) { e.Domain = domain })
+		},
+		cleanedUp: timer.cleanedUp,
+	}
+	// lego reads the propagation timeout from the optional
+	// challenge.ProviderTimeout, which the wrapper must keep exposing.
+	if t, ok := provider.(challenge.ProviderTimeout); ok {
+		return eventProviderTimeout{eventProvider: p, timeout: t}
+	}
+	return p
+}
+
+// eventProvider reports successful Present and CleanUp calls of the wrapped
+// provider.
+type eventProvider struct {
+	challenge.Provider
+	created   func(domain string)
+	cleanedUp func()
+}
+
+func (p eventProvider) Present(domain, token, keyAuth string) error {
+	if err := p.Provider.Present(domain, token, keyAuth); err != nil {
+		return err
+	}
+	p.created(domain)
+	return nil
+}
+
+func (p eventProvider) CleanUp(domain, token, keyAuth string) error {
+	err := p.Provider.CleanUp(domain, token, keyAuth)
+	p.cleanedUp()
+	return err
+}
+
+// eventProviderTimeout is an eventProvider for a provider with its own
+// propagation timeout.
+type eventProviderTimeout struct {
+	eventProvider
+	timeout challenge.ProviderTimeout
+}
+
+func (p eventProviderTimeout) Timeout() (timeout, interval time.Duration) {
+	return p.timeout.Timeout()
+}
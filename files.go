@@ -0,0 +1,153 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultOutputFileMode is the permission of files written for OutputFiles
+// when no Mode is configured.
+const DefaultOutputFileMode os.FileMode = 0600
+
+// OutputFiles configures PEM files written after each successful renewal,
+// e.g. for nginx or HAProxy. Empty paths are skipped.
+type OutputFiles struct {
+	CertPath      string // Leaf certificate
+	KeyPath       string // Private key
+	FullchainPath string // Leaf followed by the intermediates
+	CombinedPath  string // Key, leaf and intermediates in one file (HAProxy)
+	Mode          string // Octal permission bits, e.g. "0640" (default "0600")
+	Owner         string // "user" or "user:group" to chown the files to (requires privileges)
+}
+
+func (o OutputFiles) enabled() bool {
+	return o.CertPath != "" || o.KeyPath != "" || o.FullchainPath != "" || o.CombinedPath != ""
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of path
+// and renames it into place, so readers never see a partial file. A uid or
+// gid of -1 is left unchanged.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, uid, gid int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+	}
+	if uid != -1 || gid != -1 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to set owner of %s: %w", tmp.Name(), err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// fileDeployer writes the PEM files configured in OutputFiles.
+type fileDeployer struct {
+	files OutputFiles
+}
+
+func (d fileDeployer) name() string { return "output_files" }
+
+func (d fileDeployer) deploy(ctx context.Context, cert *Cert) error {
+	perm, err := parseFileMode(d.files.Mode, "OutputFiles.Mode")
+	if err != nil {
+		return err
+	}
+	uid, gid, err := lookupOwner(d.files.Owner)
+	if err != nil {
+		return err
+	}
+
+	leafPEM, _, err := cert.SplitChain()
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		path string
+		data []byte
+	}{
+		{d.files.CertPath, leafPEM},
+		{d.files.FullchainPath, []byte(cert.CertificateChain)},
+		{d.files.CombinedPath, cert.CombinedPEM()},
+		// The key goes last so a reader never pairs a new key with an old
+		// certificate.
+		{d.files.KeyPath, []byte(cert.PrivateKey)},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if err := WriteFileAtomic(f.path, f.data, perm, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFileMode parses the octal permission bits of the config field named
+// field. An empty mode is DefaultOutputFileMode.
+func parseFileMode(mode, field string) (os.FileMode, error) {
+	if mode == "" {
+		return DefaultOutputFileMode, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid %s '%s', want octal permission bits like 0640", field, mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// lookupOwner resolves "user" or "user:group" (names or numeric ids) to a
+// uid and gid. An empty owner, or an omitted group, yields -1.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	uid, gid = -1, -1
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			if u, err = user.LookupId(userName); err != nil {
+				return 0, 0, fmt.Errorf("unknown OutputFiles.Owner user '%s': %w", userName, err)
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("user '%s' has non-numeric uid '%s'", userName, u.Uid)
+		}
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return 0, 0, fmt.Errorf("unknown OutputFiles.Owner group '%s': %w", groupName, err)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("group '%s' has non-numeric gid '%s'", groupName, g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,36 @@
+package acme
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix is prepended to flag names to form their environment variables.
+const EnvPrefix = "ACME_"
+
+// FlagEnvVar returns the environment variable that provides the default of
+// the named flag, e.g. ACME_AGE_KEY for -age-key.
+func FlagEnvVar(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// FlagsFromEnv sets the named flags of fs from their environment variables.
+// Call it before fs.Parse so that flags given on the command line still take
+// precedence. Unset or empty variables leave the flag default untouched.
+func FlagsFromEnv(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("no flag -%s to read from %s", name, FlagEnvVar(name))
+		}
+		value := os.Getenv(FlagEnvVar(name))
+		if value == "" {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, FlagEnvVar(name), err)
+		}
+	}
+	return nil
+}
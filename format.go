@@ -0,0 +1,84 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the acme_config scope, as stored in the format column of the
+// SecureStore.
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// FormatFromPath returns the format of a file by its extension (.toml,
+// .json, .yaml or .yml), empty if unknown.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return ""
+}
+
+// Decode unmarshals data in format into v. JSON and YAML keys are the Go
+// field names, as in TOML, matched case-insensitively.
+func Decode(data []byte, format string, v any) error {
+	switch format {
+	case FormatTOML:
+		return toml.Unmarshal(data, v)
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	case FormatYAML:
+		// yaml.v3 would match lowercased field names only; going through
+		// JSON keeps the keys of the other formats.
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		j, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		defer Zeroize(j)
+		return json.Unmarshal(j, v)
+	}
+	return fmt.Errorf("unsupported format '%s' (supported: %s, %s, %s)", format, FormatTOML, FormatJSON, FormatYAML)
+}
+
+// Encode marshals v in format, keyed by the Go field names.
+func Encode(v any, format string) ([]byte, error) {
+	switch format {
+	case FormatTOML:
+		return toml.Marshal(v)
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatYAML:
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		defer Zeroize(j)
+		var doc any
+		if err := json.Unmarshal(j, &doc); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(doc)
+	}
+	return nil, fmt.Errorf("unsupported format '%s' (supported: %s, %s, %s)", format, FormatTOML, FormatJSON, FormatYAML)
+}
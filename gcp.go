@@ -0,0 +1,167 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	// gcpTimeout bounds the token request and the uploads together.
+	gcpTimeout = time.Minute
+
+	gcpCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+	gcpMetadataTokenURL   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCPSecretTarget writes the renewed certificate as new versions of Google
+// Cloud Secret Manager secrets, so workloads mounting the "latest" version
+// receive it. The secrets must exist; empty secret names are skipped.
+type GCPSecretTarget struct {
+	Project         string
+	FullchainSecret string `toml:",omitempty"`
+	KeySecret       string `toml:",omitempty"`
+	// JSON key of a service account allowed to add secret versions, stored
+	// encrypted with the rest of the config. Without it the service account
+	// of the GCE/GKE metadata server is used.
+	CredentialsJSON string `toml:",omitempty"`
+}
+
+// gcpDeployer adds the secret versions of one GCPSecretTarget.
+type gcpDeployer struct {
+	target GCPSecretTarget
+}
+
+func (d gcpDeployer) name() string { return "gcp_secret_manager:" + d.target.Project }
+
+func (d gcpDeployer) deploy(ctx context.Context, cert *Cert) error {
+	t := d.target
+	if t.Project == "" {
+		return fmt.Errorf("GCPSecretTarget.Project is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gcpTimeout)
+	defer cancel()
+
+	token, err := gcpToken(ctx, t.CredentialsJSON)
+	if err != nil {
+		return err
+	}
+
+	secrets := []struct {
+		name string
+		data []byte
+	}{
+		{t.FullchainSecret, []byte(cert.CertificateChain)},
+		{t.KeySecret, []byte(cert.PrivateKey)},
+	}
+	for _, s := range secrets {
+		if s.name == "" {
+			continue
+		}
+		if err := gcpAddSecretVersion(ctx, token, t.Project, s.name, s.data); err != nil {
+			return fmt.Errorf("secret '%s': %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// gcpAddSecretVersion adds data as the newest version of secret.
+func gcpAddSecretVersion(ctx context.Context, token, project, secret string, data []byte) error {
+	body, err := json.Marshal(map[string]any{
+		"payload": map[string]any{
+			"data":       data, // base64 encoded by encoding/json
+			"dataCrc32c": strconv.FormatUint(uint64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))), 10),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Secret Manager request: %w", err)
+	}
+	endpoint := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s:addVersion",
+		url.PathEscape(project), url.PathEscape(secret))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Secret Manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to add secret version: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("failed to add secret version: %s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("failed to add secret version: %s", resp.Status)
+	}
+	return nil
+}
+
+// gcpToken obtains an access token from the service account key, or from
+// the metadata server when credentialsJSON is empty.
+func gcpToken(ctx context.Context, credentialsJSON string) (string, error) {
+	if credentialsJSON != "" {
+		var key struct {
+			ClientEmail  string `json:"client_email"`
+			PrivateKey   string `json:"private_key"`
+			PrivateKeyID string `json:"private_key_id"`
+			TokenURI     string `json:"token_uri"`
+		}
+		if err := json.Unmarshal([]byte(credentialsJSON), &key); err != nil {
+			return "", fmt.Errorf("invalid GCP service account key JSON: %w", err)
+		}
+		if key.TokenURI == "" {
+			key.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		cfg := &jwt.Config{
+			Email:        key.ClientEmail,
+			PrivateKey:   []byte(key.PrivateKey),
+			PrivateKeyID: key.PrivateKeyID,
+			Scopes:       []string{gcpCloudPlatformScope},
+			TokenURL:     key.TokenURI,
+		}
+		tok, err := cfg.TokenSource(ctx).Token()
+		if err != nil {
+			return "", fmt.Errorf("failed to obtain GCP access token: %w", err)
+		}
+		return tok.AccessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata token request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain GCP access token from the metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to obtain GCP access token from the metadata server: %s", resp.Status)
+	}
+	var tok oauth2.Token
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("failed to obtain GCP access token from the metadata server: unexpected response")
+	}
+	return tok.AccessToken, nil
+}
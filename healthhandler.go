@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// DefaultHealthThreshold is the remaining validity below which HealthHandler
+// reports a certificate unhealthy. It is shorter than
+// DefaultRenewalThreshold, so a certificate only fails the check once
+// several renewal attempts were missed.
+const DefaultHealthThreshold = 14 * 24 * time.Hour
+
+// HealthStatus is the JSON body served by HealthHandler.
+type HealthStatus struct {
+	Healthy      bool         `json:"healthy"`
+	Threshold    string       `json:"threshold"`
+	Certificates []CertHealth `json:"certificates"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// CertHealth is the state of the newest stored certificate of one
+// identifier.
+type CertHealth struct {
+	Identifier    string    `json:"identifier"`
+	Domains       []string  `json:"domains"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	DaysRemaining int       `json:"days_remaining"`
+	Healthy       bool      `json:"healthy"`
+	Reason        string    `json:"reason,omitempty"` // why it is unhealthy
+}
+
+// HealthHandler serves the freshness of the certificates in the
+// ScopeAcmeCertificate scope of store, for load balancer and uptime checks.
+// The stored certificates are read at most once a minute, so probes do not
+// decrypt every version each time; the remaining validity is computed on
+// every request. It answers 200 when the newest certificate of
+// every identifier is unrevoked and valid for more than threshold
+// (DefaultHealthThreshold when zero), and 503 otherwise or when no
+// certificate is stored, always with a HealthStatus JSON body. Mount it on
+// the restinpieces router, e.g.
+// app.Router().Handle("/health/acme", acme.HealthHandler(app.ConfigStore(), 0)).
+func HealthHandler(store config.SecureStore, threshold time.Duration) http.Handler {
+	if threshold <= 0 {
+		threshold = DefaultHealthThreshold
+	}
+	certStore := newHistoryCache(newSecureCertStore(store, ScopeAcmeCertificate), historyCacheTTL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var status HealthStatus
+		if certs, err := certStore.History(); err != nil {
+			status = HealthStatus{Threshold: threshold.String(), Error: "failed to read stored certificates"}
+		} else {
+			status = CheckHealth(certs, threshold, time.Now())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// CheckHealth evaluates the newest certificate of every identifier in certs,
+// which is ordered newest first as returned by SecureCertStore.History.
+// Without certificates the status is unhealthy.
+func CheckHealth(certs []Cert, threshold time.Duration, now time.Time) HealthStatus {
+	status := HealthStatus{Healthy: true, Threshold: threshold.String(), Certificates: []CertHealth{}}
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		if seen[c.Identifier] {
+			continue
+		}
+		seen[c.Identifier] = true
+
+		remaining := c.ExpiresAt.Sub(now)
+		h := CertHealth{
+			Identifier:    c.Identifier,
+			Domains:       c.Domains,
+			ExpiresAt:     c.ExpiresAt,
+			DaysRemaining: int(remaining.Hours() / 24),
+			Healthy:       true,
+		}
+		switch {
+		case !c.RevokedAt.IsZero():
+			h.Healthy, h.Reason = false, fmt.Sprintf("revoked at %s", c.RevokedAt.Format(time.RFC3339))
+		case c.SelfSigned:
+			h.Healthy, h.Reason = false, "self-signed bootstrap certificate"
+		case remaining <= 0:
+			h.Healthy, h.Reason = false, "expired"
+		case remaining < threshold:
+			h.Healthy, h.Reason = false, fmt.Sprintf("expires within %s", threshold)
+		}
+		status.Healthy = status.Healthy && h.Healthy
+		status.Certificates = append(status.Certificates, h)
+	}
+	if len(status.Certificates) == 0 {
+		status.Healthy = false
+		status.Error = "no certificate stored"
+	}
+	return status
+}
@@ -0,0 +1,73 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHeartbeatTimeout bounds a Heartbeat ping without a Timeout.
+const DefaultHeartbeatTimeout = 10 * time.Second
+
+// Heartbeat is a healthchecks.io style ping URL hit after every renewal job,
+// so a monitor notices when the job stops running. Successful jobs ping URL,
+// failed ones URL + "/fail" with the error as body.
+type Heartbeat struct {
+	URL     string
+	Timeout string `toml:",omitempty"` // Go duration (default "10s")
+}
+
+func (b Heartbeat) enabled() bool { return b.URL != "" }
+
+// heartbeat pings the configured Heartbeat with the outcome of the job.
+// Failures to ping are logged, they never change the outcome of the job.
+func (h *Renewer) heartbeat(ctx context.Context, renewErr error) {
+	b := h.config.Heartbeat
+	if !b.enabled() {
+		return
+	}
+	if err := pingHeartbeat(ctx, b, renewErr); err != nil {
+		h.logger.Error("Heartbeat ping failed", "url", b.URL, "error", err)
+		return
+	}
+	h.logger.Debug("Heartbeat pinged", "url", b.URL, "failed", renewErr != nil)
+}
+
+// pingHeartbeat POSTs to the success or /fail URL of b.
+func pingHeartbeat(ctx context.Context, b Heartbeat, renewErr error) error {
+	timeout := DefaultHeartbeatTimeout
+	if b.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(b.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid Heartbeat.Timeout '%s', want a positive duration like 10s", b.Timeout)
+		}
+	}
+
+	endpoint, body := b.URL, ""
+	if renewErr != nil {
+		endpoint = strings.TrimRight(b.URL, "/") + "/fail"
+		body = renewErr.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create heartbeat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("heartbeat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("heartbeat returned %s", resp.Status)
+	}
+	return nil
+}
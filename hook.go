@@ -0,0 +1,82 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultHookTimeout bounds a Hook without a configured Timeout.
+const DefaultHookTimeout = time.Minute
+
+// Hook is a command run at a fixed point of the renewal, e.g.
+// "systemctl reload nginx". It is not run through a shell.
+//
+// Besides the environment of the process, the command receives
+// ACME_HOOK ("pre" or "renew"), ACME_IDENTIFIER, ACME_DOMAINS (comma
+// separated) and the configured OutputFiles paths as ACME_CERT_PATH,
+// ACME_KEY_PATH, ACME_FULLCHAIN_PATH and ACME_COMBINED_PATH. The renew hook
+// also receives
+// ACME_EXPIRES_AT (RFC 3339).
+type Hook struct {
+	Command string
+	Args    []string `toml:",omitempty"`
+	Timeout string   `toml:",omitempty"` // Go duration, e.g. "30s" (default "1m")
+}
+
+const (
+	hookPre   = "pre"
+	hookRenew = "renew"
+)
+
+// runHook runs hook as the named stage. cert is nil for the pre hook, which
+// runs before a certificate exists. The combined output is logged.
+func (h *Renewer) runHook(ctx context.Context, stage string, hook Hook, cert *Cert) error {
+	timeout := DefaultHookTimeout
+	if hook.Timeout != "" {
+		d, err := time.ParseDuration(hook.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s hook Timeout '%s', want a positive duration like 30s", stage, hook.Timeout)
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	identifier := ""
+	if len(h.config.Domains) > 0 {
+		identifier = h.config.Domains[0]
+	}
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Env = append(os.Environ(),
+		"ACME_HOOK="+stage,
+		"ACME_IDENTIFIER="+identifier,
+		"ACME_DOMAINS="+strings.Join(h.config.Domains, ","),
+		"ACME_CERT_PATH="+h.config.OutputFiles.CertPath,
+		"ACME_KEY_PATH="+h.config.OutputFiles.KeyPath,
+		"ACME_FULLCHAIN_PATH="+h.config.OutputFiles.FullchainPath,
+		"ACME_COMBINED_PATH="+h.config.OutputFiles.CombinedPath,
+	)
+	if cert != nil {
+		cmd.Env = append(cmd.Env, "ACME_EXPIRES_AT="+cert.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	h.logger.Info("Running hook", "hook", stage, "command", hook.Command, "args", hook.Args, "timeout", timeout)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		h.logger.Info("Hook output", "hook", stage, "output", strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s hook '%s' timed out after %s", stage, hook.Command, timeout)
+		}
+		return fmt.Errorf("%s hook '%s' failed: %w", stage, hook.Command, err)
+	}
+	h.logger.Info("Hook completed", "hook", stage, "command", hook.Command)
+	return nil
+}
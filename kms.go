@@ -0,0 +1,265 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+)
+
+// kmsTimeout bounds one key wrap or unwrap call to the KMS.
+const kmsTimeout = 30 * time.Second
+
+// kmsBlobMagic starts every blob saved by a KMS SecureStore, telling it apart
+// from age ciphertext.
+var kmsBlobMagic = []byte("restinpieces-acme/kms/v1\n")
+
+// BlobCipher encrypts and decrypts the blobs a SecureStore saves in the
+// database. EnvelopeCipher is the implementation backed by a KeyWrapper.
+type BlobCipher interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// KeyWrapper encrypts and decrypts small data keys with a key that never
+// leaves a key management service: AWSKMS, GCPKMS or VaultTransit.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// EnvelopeCipher is a BlobCipher doing envelope encryption: every blob is
+// encrypted with a fresh AES-256-GCM data key, which is stored next to it
+// wrapped by the KMS, so the KMS is called once per blob regardless of its
+// size.
+type EnvelopeCipher struct {
+	Wrapper KeyWrapper
+}
+
+// Encrypt implements BlobCipher. The result is kmsBlobMagic, the big endian
+// uint16 length of the wrapped data key, the wrapped key, the GCM nonce and
+// the sealed plaintext.
+func (c EnvelopeCipher) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	defer clear(dataKey)
+
+	wrapped, err := c.Wrapper.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	if len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("wrapped data key too large (%d bytes)", len(wrapped))
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte{}, kmsBlobMagic...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	out = append(out, nonce...)
+	// The header is authenticated, so the wrapped key cannot be swapped.
+	return aead.Seal(out, nonce, plaintext, out), nil
+}
+
+// Decrypt implements BlobCipher.
+func (c EnvelopeCipher) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if !isKMSBlob(ciphertext) {
+		return nil, fmt.Errorf("not a KMS encrypted blob")
+	}
+	rest := ciphertext[len(kmsBlobMagic):]
+	if len(rest) < 2 {
+		return nil, fmt.Errorf("truncated KMS blob")
+	}
+	n := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+n {
+		return nil, fmt.Errorf("truncated KMS blob")
+	}
+	wrapped := rest[2 : 2+n]
+
+	dataKey, err := c.Wrapper.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	defer clear(dataKey)
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(kmsBlobMagic) + 2 + n
+	if len(ciphertext) < headerLen+aead.NonceSize() {
+		return nil, fmt.Errorf("truncated KMS blob")
+	}
+	nonce := ciphertext[headerLen : headerLen+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[headerLen+aead.NonceSize():], ciphertext[:headerLen+aead.NonceSize()])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt KMS blob: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+func isKMSBlob(data []byte) bool {
+	return bytes.HasPrefix(data, kmsBlobMagic)
+}
+
+// NewKMSSecureStore returns a SecureStore encrypting the scopes named by
+// scopes with EnvelopeCipher and the KeyWrapper described by kmsURI (see
+// ParseKMSURI), for organizations with centralized key management that do
+// not want to distribute age key files. Versions not saved by a KMS store,
+// e.g. age encrypted ones from before the switch, are read through legacy
+// when it is not nil.
+func NewKMSSecureStore(dbCfg db.DbConfig, kmsURI string, legacy config.SecureStore, scopes ...Scopes) (config.SecureStore, error) {
+	wrapper, err := ParseKMSURI(kmsURI)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipherStore(dbCfg, EnvelopeCipher{Wrapper: wrapper}, legacy, scopes...), nil
+}
+
+// NewCipherStore returns a SecureStore encrypting with c the scopes named by
+// scopes, or by DefaultScopes when none is given; pass every Scopes the store
+// is wrapped with by NewScopedStore. Other scopes, such as the restinpieces
+// application config the server reads with age, are saved through legacy,
+// and refused when it is nil. Blobs that do not start with the KMS header
+// are read through legacy when it is not nil.
+func NewCipherStore(dbCfg db.DbConfig, c BlobCipher, legacy config.SecureStore, scopes ...Scopes) config.SecureStore {
+	if len(scopes) == 0 {
+		scopes = []Scopes{DefaultScopes()}
+	}
+	encrypted := make(map[string]bool)
+	for _, s := range scopes {
+		for _, name := range s.withDefaults().All() {
+			encrypted[name] = true
+		}
+	}
+	return &cipherStore{dbCfg: dbCfg, cipher: c, legacy: legacy, encrypted: encrypted}
+}
+
+// cipherStore is a config.SecureStore encrypting with a BlobCipher.
+type cipherStore struct {
+	dbCfg     db.DbConfig
+	cipher    BlobCipher
+	legacy    config.SecureStore
+	encrypted map[string]bool // names of the scopes encrypted with cipher
+}
+
+// Get implements config.SecureStore.
+func (s *cipherStore) Get(scope string, generation int) ([]byte, string, error) {
+	if generation < 0 {
+		return nil, "", fmt.Errorf("generation cannot be negative")
+	}
+	if scope == "" {
+		scope = config.ScopeApplication
+	}
+	encrypted, format, err := s.dbCfg.GetConfig(scope, generation)
+	if err != nil {
+		return nil, "", fmt.Errorf("securestore: failed to get config: %w", err)
+	}
+	if len(encrypted) == 0 {
+		return encrypted, format, nil
+	}
+	if !isKMSBlob(encrypted) {
+		if s.legacy == nil {
+			return nil, "", fmt.Errorf("securestore: scope '%s' generation %d is not KMS encrypted and no age key was given to read it", scope, generation)
+		}
+		return s.legacy.Get(scope, generation)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	plaintext, err := s.cipher.Decrypt(ctx, encrypted)
+	if err != nil {
+		return nil, "", fmt.Errorf("securestore: decrypt failed: %w", err)
+	}
+	return plaintext, format, nil
+}
+
+// Save implements config.SecureStore.
+func (s *cipherStore) Save(scope string, plaintextData []byte, format string, description string) error {
+	if !s.encrypted[scope] {
+		if s.legacy == nil {
+			return fmt.Errorf("securestore: scope '%s' is not one of the acme scopes and is not KMS encrypted; an age key is needed to save it", scope)
+		}
+		return s.legacy.Save(scope, plaintextData, format, description)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	encrypted, err := s.cipher.Encrypt(ctx, plaintextData)
+	if err != nil {
+		return fmt.Errorf("securestore: failed to encrypt config for scope '%s': %w", scope, err)
+	}
+	if err := s.dbCfg.InsertConfig(scope, encrypted, format, description); err != nil {
+		return fmt.Errorf("securestore: failed to insert config for scope '%s': %w", scope, err)
+	}
+	return nil
+}
+
+// ParseKMSURI returns the KeyWrapper for uri:
+//
+//	awskms://<key id, ARN or alias/name>?region=<region>
+//	gcpkms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>
+//	vault://<mount>/<key>   (Vault transit; VAULT_ADDR and VAULT_TOKEN from the environment)
+//
+// AWS uses the default credential chain; GCP the service account key file
+// in GOOGLE_APPLICATION_CREDENTIALS, or the metadata server.
+func ParseKMSURI(uri string) (KeyWrapper, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("invalid KMS URI '%s', want awskms://, gcpkms:// or vault://", uri)
+	}
+	switch scheme {
+	case "awskms":
+		keyID, query, _ := strings.Cut(rest, "?")
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KMS URI '%s': %w", uri, err)
+		}
+		w := AWSKMS{KeyID: keyID, Region: values.Get("region")}
+		if w.Region == "" {
+			return nil, fmt.Errorf("invalid KMS URI '%s': missing ?region=", uri)
+		}
+		return w, nil
+	case "gcpkms":
+		if !strings.HasPrefix(rest, "projects/") || !strings.Contains(rest, "/cryptoKeys/") {
+			return nil, fmt.Errorf("invalid KMS URI '%s', want gcpkms://projects/P/locations/L/keyRings/R/cryptoKeys/K", uri)
+		}
+		return GCPKMS{KeyName: rest}, nil
+	case "vault":
+		mount, key, ok := strings.Cut(rest, "/")
+		if !ok || mount == "" || key == "" {
+			return nil, fmt.Errorf("invalid KMS URI '%s', want vault://<mount>/<key>", uri)
+		}
+		return VaultTransit{Mount: mount, Key: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported KMS URI scheme '%s' (want awskms, gcpkms or vault)", scheme)
+	}
+}
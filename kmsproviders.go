@@ -0,0 +1,224 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// AWSKMS wraps data keys with the AWS KMS symmetric key KeyID (key ID, ARN or
+// "alias/name") in Region, using the AWS default credential chain.
+type AWSKMS struct {
+	KeyID  string
+	Region string
+}
+
+// WrapKey implements KeyWrapper.
+func (k AWSKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct{ CiphertextBlob []byte }
+	err := k.call(ctx, "TrentService.Encrypt", map[string]any{"KeyId": k.KeyID, "Plaintext": dataKey}, &out)
+	return out.CiphertextBlob, err
+}
+
+// UnwrapKey implements KeyWrapper.
+func (k AWSKMS) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct{ Plaintext []byte }
+	err := k.call(ctx, "TrentService.Decrypt", map[string]any{"KeyId": k.KeyID, "CiphertextBlob": wrapped}, &out)
+	return out.Plaintext, err
+}
+
+// call runs a KMS action over the AWS JSON protocol with a SigV4 signature,
+// like the ACM target. Blobs are base64 encoded by encoding/json.
+func (k AWSKMS) call(ctx context.Context, target string, in, out any) error {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(k.Region))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal KMS request: %w", err)
+	}
+	endpoint := fmt.Sprintf("https://kms.%s.amazonaws.com/", k.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create KMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	payloadHash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "kms", k.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign KMS request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("AWS KMS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Type != "" {
+			return fmt.Errorf("AWS KMS request failed: %s: %s", apiErr.Type, apiErr.Message)
+		}
+		return fmt.Errorf("AWS KMS request failed: %s", resp.Status)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode AWS KMS response: %w", err)
+	}
+	return nil
+}
+
+// GCPKMS wraps data keys with the Cloud KMS symmetric key KeyName
+// ("projects/P/locations/L/keyRings/R/cryptoKeys/K"). It authenticates with
+// the service account key file in GOOGLE_APPLICATION_CREDENTIALS, or the
+// metadata server when unset.
+type GCPKMS struct {
+	KeyName string
+}
+
+// WrapKey implements KeyWrapper.
+func (k GCPKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := k.call(ctx, "encrypt", map[string]any{"plaintext": dataKey}, &out)
+	return out.Ciphertext, err
+}
+
+// UnwrapKey implements KeyWrapper.
+func (k GCPKMS) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := k.call(ctx, "decrypt", map[string]any{"ciphertext": wrapped}, &out)
+	return out.Plaintext, err
+}
+
+func (k GCPKMS) call(ctx context.Context, method string, in, out any) error {
+	var credentialsJSON string
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+		}
+		credentialsJSON = string(data)
+	}
+	token, err := gcpToken(ctx, credentialsJSON)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Cloud KMS request: %w", err)
+	}
+	endpoint := fmt.Sprintf("https://cloudkms.googleapis.com/v1/%s:%s", k.KeyName, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Cloud KMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return doJSON(req, "Cloud KMS", out)
+}
+
+// VaultTransit wraps data keys with the transit key Key of the secrets
+// engine mounted at Mount of the Vault server in VAULT_ADDR, authenticating
+// with VAULT_TOKEN.
+type VaultTransit struct {
+	Mount string
+	Key   string
+}
+
+// WrapKey implements KeyWrapper.
+func (v VaultTransit) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, "encrypt", map[string]any{"plaintext": dataKey}, &out); err != nil {
+		return nil, err
+	}
+	return []byte(out.Data.Ciphertext), nil
+}
+
+// UnwrapKey implements KeyWrapper.
+func (v VaultTransit) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Plaintext []byte `json:"plaintext"`
+		} `json:"data"`
+	}
+	err := v.call(ctx, "decrypt", map[string]any{"ciphertext": string(wrapped)}, &out)
+	return out.Data.Plaintext, err
+}
+
+func (v VaultTransit) call(ctx context.Context, op string, in, out any) error {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set for Vault transit")
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Vault request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimRight(addr, "/"), v.Mount, op, v.Key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", token)
+	return doJSON(req, "Vault transit", out)
+}
+
+// doJSON sends req and decodes a 200 response into out. Errors include the
+// "message" (Google) or "errors" (Vault) detail of the response.
+func doJSON(req *http.Request, service string, out any) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil {
+			if apiErr.Error.Message != "" {
+				return fmt.Errorf("%s request failed: %s: %s", service, resp.Status, apiErr.Error.Message)
+			}
+			if len(apiErr.Errors) > 0 {
+				return fmt.Errorf("%s request failed: %s: %s", service, resp.Status, strings.Join(apiErr.Errors, "; "))
+			}
+		}
+		return fmt.Errorf("%s request failed: %s", service, resp.Status)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", service, err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+
+	legolog "github.com/go-acme/lego/v4/log"
+)
+
+// Log formats accepted by NewLogger.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger returns a slog logger writing to w in the given format at level,
+// and routes lego's own log output through it (see SetLegoLogger) so ACME
+// and DNS progress messages share the format and are dropped below level.
+func NewLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format '%s' (want %s or %s)", format, LogFormatText, LogFormatJSON)
+	}
+
+	logger := slog.New(handler)
+	SetLegoLogger(logger)
+	return logger, nil
+}
+
+// SetLegoLogger routes lego's global log output, including challenge and DNS
+// propagation progress, into logger with a component=lego attribute. lego
+// marks messages with "[INFO] " or "[WARN] " prefixes, which become slog
+// levels, and a leading "[domain] " becomes a domain attribute.
+//
+// lego has one logger per process. While a Renewer runs, the lines of its
+// domains go to its own lego logger instead (see Renewer.SetLegoLogger), so
+// handlers for staging and production certificates in one process log
+// attributed lines; logger gets the lines no single run can be matched to.
+// The last call wins.
+func SetLegoLogger(logger *slog.Logger) {
+	legoLogs.setFallback(logger.With("component", "lego"))
+	legolog.Logger = log.New(legoLogs, "", 0)
+}
+
+// installLegoRouter routes lego's log output to logger like SetLegoLogger,
+// unless a logger was already set.
+func installLegoRouter(logger *slog.Logger) {
+	legoLogs.mu.Lock()
+	installed := legoLogs.fallback != nil
+	legoLogs.mu.Unlock()
+	if !installed {
+		SetLegoLogger(logger)
+	}
+}
+
+// legoLogs is the log.Logger output installed in lego by SetLegoLogger.
+var legoLogs = &legoRouter{runs: make(map[*legoRun]struct{})}
+
+// legoRouter turns the lines lego writes to its log.Logger into slog records
+// on the logger of the running Renewer they belong to.
+type legoRouter struct {
+	mu       sync.Mutex
+	fallback *slog.Logger
+	runs     map[*legoRun]struct{}
+}
+
+// legoRun is a Renewer talking to the CA for domains.
+type legoRun struct {
+	logger  *slog.Logger
+	domains []string
+}
+
+func (r *legoRouter) setFallback(logger *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = logger
+}
+
+// begin routes the lines of domains to logger until end is called with the
+// returned run.
+func (r *legoRouter) begin(logger *slog.Logger, domains []string) *legoRun {
+	run := &legoRun{logger: logger, domains: domains}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[run] = struct{}{}
+	return run
+}
+
+func (r *legoRouter) end(run *legoRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, run)
+}
+
+// route returns the logger of the only run for domain, or of the only run
+// if the line names no domain, and the fallback logger otherwise.
+func (r *legoRouter) route(domain string) *slog.Logger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var match *legoRun
+	for run := range r.runs {
+		if domain != "" && !run.covers(domain) {
+			continue
+		}
+		if match != nil {
+			return r.fallback
+		}
+		match = run
+	}
+	if match == nil {
+		return r.fallback
+	}
+	return match.logger
+}
+
+// covers reports whether domain, as lego names it in a log line, is one of
+// the domains of run. lego names a wildcard by its base domain in some lines.
+func (run *legoRun) covers(domain string) bool {
+	for _, d := range run.domains {
+		if d == domain || strings.TrimPrefix(d, "*.") == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *legoRouter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+
+	level := slog.LevelInfo
+	switch {
+	case strings.HasPrefix(msg, "[INFO] "):
+		msg = strings.TrimPrefix(msg, "[INFO] ")
+	case strings.HasPrefix(msg, "[WARN] "):
+		msg = strings.TrimPrefix(msg, "[WARN] ")
+		level = slog.LevelWarn
+	}
+
+	var domain string
+	var attrs []slog.Attr
+	if strings.HasPrefix(msg, "[") {
+		if d, rest, ok := strings.Cut(msg[1:], "] "); ok && !strings.ContainsAny(d, " []") {
+			domain = d
+			attrs = append(attrs, slog.String("domain", domain))
+			msg = rest
+		}
+	}
+	if logger := r.route(domain); logger != nil {
+		logger.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+	return len(p), nil
+}
+
+// LogLevel maps the -log-level, -quiet and -debug command-line flags to a
+// level. -quiet and -debug take precedence over -log-level; an empty name is
+// info.
+func LogLevel(name string, quiet, debug bool) (slog.Level, error) {
+	switch {
+	case quiet && debug:
+		return 0, fmt.Errorf("-quiet and -debug are mutually exclusive")
+	case quiet:
+		return slog.LevelWarn, nil
+	case debug:
+		return slog.LevelDebug, nil
+	case name == "":
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level '%s' (want debug, info, warn or error)", name)
+	}
+	return level, nil
+}
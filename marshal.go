@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// MarshalCert encodes c as the TOML saved in the certificate scope. The
+// output only depends on the values of c: fields come in declaration order
+// and timestamps in UTC with second precision (RFC 3339, "Z" suffix), so the
+// versions of a scope diff cleanly and can be compared with golden files.
+// Sub-second parts, which no certificate timestamp has, are dropped.
+func MarshalCert(c Cert) ([]byte, error) {
+	c.IssuedAt = canonicalTime(c.IssuedAt)
+	c.ExpiresAt = canonicalTime(c.ExpiresAt)
+	c.RevokedAt = canonicalTime(c.RevokedAt)
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal certificate data to TOML: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalCert decodes the TOML of a certificate scope. Domains is a TOML
+// array of strings; versions that stored it as a string holding a JSON array
+// (or a comma separated list) decode to the same []string, so consumers
+// never parse it themselves.
+func UnmarshalCert(data []byte) (*Cert, error) {
+	var stored struct {
+		Cert
+		Domains any
+	}
+	if err := toml.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal certificate TOML: %w", err)
+	}
+	domains, err := decodeDomains(stored.Domains)
+	if err != nil {
+		return nil, err
+	}
+	cert := stored.Cert
+	cert.Domains = domains
+	return &cert, nil
+}
+
+// decodeDomains returns the Domains field of a stored certificate as a
+// []string.
+func decodeDomains(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		domains := make([]string, 0, len(v))
+		for _, d := range v {
+			s, ok := d.(string)
+			if !ok {
+				return nil, fmt.Errorf("certificate Domains holds a %T, expected strings", d)
+			}
+			domains = append(domains, s)
+		}
+		return domains, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return nil, nil
+		}
+		if strings.HasPrefix(s, "[") {
+			var domains []string
+			if err := json.Unmarshal([]byte(s), &domains); err != nil {
+				return nil, fmt.Errorf("failed to decode certificate Domains '%s': %w", v, err)
+			}
+			return domains, nil
+		}
+		var domains []string
+		for _, d := range strings.Split(s, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				domains = append(domains, d)
+			}
+		}
+		return domains, nil
+	}
+	return nil, fmt.Errorf("certificate Domains is a %T, expected an array of strings", v)
+}
+
+// MarshalConfig encodes cfg as the TOML of the acme_config scope: fields in
+// declaration order and DNSProviders sorted by name, so equal configs encode
+// to equal bytes.
+func MarshalConfig(cfg *Config) ([]byte, error) {
+	data, err := toml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ACME config to TOML: %w", err)
+	}
+	return data, nil
+}
+
+// canonicalTime returns t in UTC, truncated to the second.
+func canonicalTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
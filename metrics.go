@@ -0,0 +1,123 @@
+package acme
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the Prometheus collectors of a CertRenewalHandler. All series
+// are labelled by certificate identifier. A nil *Metrics records nothing.
+type Metrics struct {
+	attempts  *prometheus.CounterVec
+	successes *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	phases    *prometheus.HistogramVec
+	expiry    *prometheus.GaugeVec
+}
+
+// NewMetrics creates the renewal metrics and registers them with reg, e.g.
+// prometheus.DefaultRegisterer or the registry the host application serves
+// on /metrics with promhttp.HandlerFor.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	labels := []string{"identifier"}
+	m := &Metrics{
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "acme_renewal_attempts_total",
+			Help: "Certificate renewal jobs started.",
+		}, labels),
+		successes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "acme_renewal_success_total",
+			Help: "Certificate renewals that obtained, saved and deployed a certificate.",
+		}, labels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "acme_renewal_failures_total",
+			Help: "Certificate renewal jobs that returned an error.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "acme_renewal_duration_seconds",
+			Help: "Duration of certificate renewal jobs, including DNS propagation.",
+			// dns-01 renewals take from seconds to several minutes.
+			Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1200},
+		}, labels),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "acme_renewal_phase_duration_seconds",
+			Help:    "Duration of the phases of certificate orders: dns_propagation, finalization and issuance.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600},
+		}, []string{"identifier", "phase"}),
+		expiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "acme_cert_expiry_timestamp_seconds",
+			Help: "Expiry (NotAfter) of the current stored certificate.",
+		}, labels),
+	}
+	for _, c := range []prometheus.Collector{m.attempts, m.successes, m.failures, m.duration, m.phases, m.expiry} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register ACME metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// SetMetrics makes the handler record its renewals in m. The expiry gauge is
+// seeded from the certificates already stored, so it is set before the first
+// renewal runs.
+func (h *Renewer) SetMetrics(m *Metrics) {
+	h.metrics = m
+	if m == nil {
+		return
+	}
+	s, ok := h.writer.(*SecureCertStore)
+	if !ok {
+		return
+	}
+	certs, err := s.Current()
+	if err != nil {
+		h.logger.Warn("Failed to load stored certificates for metrics", "error", err)
+		return
+	}
+	for i := range certs {
+		m.setExpiry(&certs[i])
+	}
+}
+
+// observeRenewal records one renewal job of identifier that started at start
+// and ended with err.
+func (m *Metrics) observeRenewal(identifier string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.attempts.WithLabelValues(identifier).Inc()
+	m.duration.WithLabelValues(identifier).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.failures.WithLabelValues(identifier).Inc()
+		return
+	}
+	m.successes.WithLabelValues(identifier).Inc()
+}
+
+// observePhases records the phase durations of one certificate order. Phases
+// not reached are left out.
+func (m *Metrics) observePhases(rt RenewalTimings) {
+	if m == nil {
+		return
+	}
+	for phase, seconds := range map[string]float64{
+		"dns_propagation": rt.DNSPropagationSeconds,
+		"finalization":    rt.FinalizationSeconds,
+		"issuance":        rt.IssuanceSeconds,
+	} {
+		if seconds > 0 {
+			m.phases.WithLabelValues(rt.Identifier, phase).Observe(seconds)
+		}
+	}
+}
+
+// setExpiry records the expiry of cert as the current one of its identifier.
+func (m *Metrics) setExpiry(cert *Cert) {
+	if m == nil {
+		return
+	}
+	m.expiry.WithLabelValues(cert.Identifier).Set(float64(cert.ExpiresAt.Unix()))
+}
@@ -0,0 +1,101 @@
+package acme
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// MetricsHandler serves the expiry and renewal status of the certificates in
+// the ScopeAcmeCertificate scope of store in the Prometheus text format. The
+// stored certificates are read at most once a minute, as decrypting every
+// version on each scrape is slow and, with age plugin identities, may need a
+// hardware token. Mount it on the restinpieces router, e.g.
+// app.Router().Handle("/metrics/acme", acme.MetricsHandler(app.ConfigStore())).
+// It exports acme_cert_expiry_timestamp_seconds like Metrics, so serve only
+// one of them on the same endpoint.
+func MetricsHandler(store config.SecureStore) http.Handler {
+	certStore := newHistoryCache(newSecureCertStore(store, ScopeAcmeCertificate), historyCacheTTL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		certs, err := certStore.History()
+		if err != nil {
+			http.Error(w, "failed to read stored certificates", http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		if err := WriteCertMetrics(&buf, certs, time.Now()); err != nil {
+			http.Error(w, "failed to render metrics", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// WriteCertMetrics writes Prometheus text format metrics for the newest
+// certificate of every identifier in certs, which is ordered newest first as
+// returned by SecureCertStore.History. Renewal is due as decided by
+// RenewalDue with DefaultRenewalThreshold.
+func WriteCertMetrics(w io.Writer, certs []Cert, now time.Time) error {
+	var latest []Cert
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		if seen[c.Identifier] {
+			continue
+		}
+		seen[c.Identifier] = true
+		latest = append(latest, c)
+	}
+
+	metrics := []struct {
+		name, help string
+		value      func(c *Cert) int64
+	}{
+		{"acme_cert_expiry_timestamp_seconds", "Expiry (NotAfter) of the newest stored certificate.",
+			func(c *Cert) int64 { return c.ExpiresAt.Unix() }},
+		{"acme_last_renewal_success_timestamp", "Issuance (NotBefore) of the newest stored certificate.",
+			func(c *Cert) int64 { return c.IssuedAt.Unix() }},
+		{"acme_cert_revoked", "Whether the newest stored certificate was revoked.",
+			func(c *Cert) int64 { return boolValue(!c.RevokedAt.IsZero()) }},
+		{"acme_cert_renewal_due", "Whether the newest stored certificate is due for renewal.",
+			func(c *Cert) int64 {
+				due, _ := RenewalDue(c, c.Domains, DefaultRenewalThreshold, now)
+				return boolValue(due)
+			}},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", m.name)
+		for i := range latest {
+			fmt.Fprintf(&buf, "%s{identifier=%s} %d\n", m.name, labelValue(latest[i].Identifier), m.value(&latest[i]))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes s as a Prometheus label value.
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,165 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+	"github.com/domodwyer/mailyak/v3"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// notifyTimeout bounds sending one notification email.
+const notifyTimeout = 30 * time.Second
+
+// EmailNotification configures the email sent after a renewal job. Without
+// recipients nothing is sent.
+type EmailNotification struct {
+	To        []string
+	OnSuccess bool // Also notify successful renewals, not only failures
+	// SMTP server to send through. When unset the [smtp] section of the
+	// restinpieces application config (config.ScopeApplication) is used.
+	Smtp *config.Smtp `toml:",omitempty"`
+}
+
+func (n EmailNotification) enabled() bool { return len(n.To) > 0 }
+
+// notify emails the outcome of a renewal job. Failures to send are logged,
+// they never change the outcome of the job.
+func (h *Renewer) notify(ctx context.Context, job db.Job, identifier string, renewErr error) {
+	n := h.config.EmailNotification
+	if !n.enabled() || (renewErr == nil && !n.OnSuccess) {
+		return
+	}
+
+	subject, body := notificationMessage(h.config.Domains, identifier, job, renewErr, h.clock.Now())
+	if err := sendEmail(ctx, h.secureConfigStore, n.Smtp, n.To, subject, body, ""); err != nil {
+		h.logger.Error("Failed to send renewal notification email", "to", n.To, "error", err)
+		return
+	}
+	h.logger.Info("Sent renewal notification email", "to", n.To)
+}
+
+// notificationMessage builds the subject and plain text body for the outcome
+// of job. The next attempt is only known for recurrent jobs.
+func notificationMessage(domains []string, identifier string, job db.Job, renewErr error, now time.Time) (subject, body string) {
+	var b strings.Builder
+	if renewErr != nil {
+		subject = fmt.Sprintf("Certificate renewal failed for %s", identifier)
+		fmt.Fprintf(&b, "Renewing the certificate %s failed.\n\n", identifier)
+	} else {
+		subject = fmt.Sprintf("Certificate renewed for %s", identifier)
+		fmt.Fprintf(&b, "The certificate %s was renewed and deployed.\n\n", identifier)
+	}
+	fmt.Fprintf(&b, "Domains: %s\n", strings.Join(domains, ", "))
+	fmt.Fprintf(&b, "Time: %s\n", now.UTC().Format(time.RFC3339))
+	if renewErr != nil {
+		fmt.Fprintf(&b, "Error: %v\n", renewErr)
+		if job.MaxAttempts > 0 {
+			fmt.Fprintf(&b, "Attempt: %d of %d\n", job.Attempts, job.MaxAttempts)
+		}
+	}
+	if job.Recurrent && job.Interval > 0 {
+		fmt.Fprintf(&b, "Next attempt: %s\n", now.Add(job.Interval).UTC().Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(&b, "Next attempt: not scheduled\n")
+	}
+	return subject, b.String()
+}
+
+// sendEmail sends a message with a plain text and, when html is set, an HTML
+// part to the recipients to, through smtpCfg or, when nil, the SMTP server of
+// the application config in store.
+func sendEmail(ctx context.Context, store ConfigReader, smtpCfg *config.Smtp, to []string, subject, plain, html string) error {
+	if smtpCfg == nil {
+		appSmtp, err := appSmtpConfig(store)
+		if err != nil {
+			return err
+		}
+		smtpCfg = appSmtp
+	}
+	mail, err := newMailClient(smtpCfg)
+	if err != nil {
+		return err
+	}
+	mail.To(to...)
+	mail.FromName(smtpCfg.FromName)
+	mail.From(smtpCfg.FromAddress)
+	mail.Subject(subject)
+	mail.Plain().Set(plain)
+	if html != "" {
+		mail.HTML().Set(html)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- mail.Send() }()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// appSmtpConfig returns the enabled [smtp] section of the latest restinpieces
+// application config.
+func appSmtpConfig(store ConfigReader) (*config.Smtp, error) {
+	data, format, err := store.Get(config.ScopeApplication, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no EmailNotification.Smtp set and failed to load application config: %w", err)
+	}
+	defer Zeroize(data)
+	if format != "toml" {
+		return nil, fmt.Errorf("application config in scope '%s' is in format '%s', expected 'toml'", config.ScopeApplication, format)
+	}
+	var appCfg config.Config
+	if err := toml.Unmarshal(data, &appCfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal application config: %w", err)
+	}
+	if !appCfg.Smtp.Enabled {
+		return nil, fmt.Errorf("no EmailNotification.Smtp set and SMTP is disabled in the application config")
+	}
+	return &appCfg.Smtp, nil
+}
+
+// newMailClient connects mailyak like the restinpieces mailer does: direct
+// TLS with UseTLS, otherwise STARTTLS when the server offers it.
+func newMailClient(smtpCfg *config.Smtp) (*mailyak.MailYak, error) {
+	if smtpCfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is not configured")
+	}
+
+	var auth smtp.Auth
+	switch smtpCfg.AuthMethod {
+	case "cram-md5":
+		auth = smtp.CRAMMD5Auth(smtpCfg.Username, smtpCfg.Password)
+	case "none":
+	case "", "plain":
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	default:
+		return nil, fmt.Errorf("unsupported SMTP auth method '%s' (want plain, cram-md5 or none)", smtpCfg.AuthMethod)
+	}
+
+	addr := fmt.Sprintf("%s:%d", smtpCfg.Host, smtpCfg.Port)
+	var mail *mailyak.MailYak
+	if smtpCfg.UseTLS {
+		var err error
+		mail, err = mailyak.NewWithTLS(addr, auth, &tls.Config{ServerName: smtpCfg.Host})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SMTP client: %w", err)
+		}
+	} else {
+		mail = mailyak.New(addr, auth)
+	}
+	if smtpCfg.LocalName != "" {
+		mail.LocalName(smtpCfg.LocalName)
+	}
+	return mail, nil
+}
@@ -0,0 +1,123 @@
+package acme
+
+import (
+	"context"
+	"time"
+
+	"github.com/caasmo/restinpieces/db"
+)
+
+// RenewalRun describes the renewal an observer is notified of.
+type RenewalRun struct {
+	Job        db.Job
+	Identifier string    // Identifier of the certificate being renewed
+	Domains    []string  // Requested domains
+	StartedAt  time.Time // from the Clock of the Renewer
+}
+
+// RenewalObserver is notified of every renewal that contacts the CA:
+// OnStart before the order, then OnSuccess with the saved and deployed
+// certificate or OnFailure with the error of the run, also when a
+// deployment failed after the certificate was saved (which does not fail
+// the job). Runs skipped by a
+// RenewalPayload are not observed.
+//
+// The metrics, notification email and alerting of the Renewer are observers
+// too; those added with AddObserver are called after them, in the
+// order added. The methods are called synchronously from the renewal, so
+// they should return quickly, and cannot change its outcome.
+type RenewalObserver interface {
+	OnStart(ctx context.Context, run RenewalRun)
+	OnSuccess(ctx context.Context, run RenewalRun, cert *Cert)
+	OnFailure(ctx context.Context, run RenewalRun, err error)
+}
+
+// ObserverFuncs adapts functions to a RenewalObserver. Nil functions are
+// skipped.
+type ObserverFuncs struct {
+	Start   func(ctx context.Context, run RenewalRun)
+	Success func(ctx context.Context, run RenewalRun, cert *Cert)
+	Failure func(ctx context.Context, run RenewalRun, err error)
+}
+
+// OnStart calls f.Start.
+func (f ObserverFuncs) OnStart(ctx context.Context, run RenewalRun) {
+	if f.Start != nil {
+		f.Start(ctx, run)
+	}
+}
+
+// OnSuccess calls f.Success.
+func (f ObserverFuncs) OnSuccess(ctx context.Context, run RenewalRun, cert *Cert) {
+	if f.Success != nil {
+		f.Success(ctx, run, cert)
+	}
+}
+
+// OnFailure calls f.Failure.
+func (f ObserverFuncs) OnFailure(ctx context.Context, run RenewalRun, err error) {
+	if f.Failure != nil {
+		f.Failure(ctx, run, err)
+	}
+}
+
+// AddObserver registers o to be notified of every renewal.
+func (h *Renewer) AddObserver(o RenewalObserver) {
+	h.observers = append(h.observers, o)
+}
+
+// observerChain returns the built-in observers followed by the added ones.
+func (h *Renewer) observerChain() []RenewalObserver {
+	builtin := []RenewalObserver{
+		&metricsObserver{m: h.metrics},
+		notificationObserver{h},
+		alertObserver{h},
+	}
+	return append(builtin, h.observers...)
+}
+
+// metricsObserver counts renewals in the Metrics of SetMetrics. The
+// duration is measured from OnStart with the monotonic wall clock, not from
+// the StartedAt of the Clock.
+type metricsObserver struct {
+	m     *Metrics
+	start time.Time
+}
+
+func (o *metricsObserver) OnStart(context.Context, RenewalRun) {
+	o.start = time.Now()
+}
+
+func (o *metricsObserver) OnSuccess(_ context.Context, run RenewalRun, _ *Cert) {
+	o.m.observeRenewal(run.Identifier, o.start, nil)
+}
+
+func (o *metricsObserver) OnFailure(_ context.Context, run RenewalRun, err error) {
+	o.m.observeRenewal(run.Identifier, o.start, err)
+}
+
+// notificationObserver sends the EmailNotification of the config.
+type notificationObserver struct{ h *Renewer }
+
+func (o notificationObserver) OnStart(context.Context, RenewalRun) {}
+
+func (o notificationObserver) OnSuccess(ctx context.Context, run RenewalRun, _ *Cert) {
+	o.h.notify(ctx, run.Job, run.Identifier, nil)
+}
+
+func (o notificationObserver) OnFailure(ctx context.Context, run RenewalRun, err error) {
+	o.h.notify(ctx, run.Job, run.Identifier, err)
+}
+
+// alertObserver updates the Alerting incidents of the config.
+type alertObserver struct{ h *Renewer }
+
+func (o alertObserver) OnStart(context.Context, RenewalRun) {}
+
+func (o alertObserver) OnSuccess(ctx context.Context, run RenewalRun, _ *Cert) {
+	o.h.alert(ctx, run.Identifier, nil)
+}
+
+func (o alertObserver) OnFailure(ctx context.Context, run RenewalRun, err error) {
+	o.h.alert(ctx, run.Identifier, err)
+}
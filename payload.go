@@ -0,0 +1,69 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/caasmo/restinpieces/db"
+)
+
+// RenewalPayload is the JSON payload of a renewal job, e.g.
+//
+//	{"identifier": "example.com", "force": true}
+//
+// A job with a payload only renews when the stored certificate is due
+// (RenewalDue with the RenewalThreshold of the config) unless Force is set;
+// a job without one renews unconditionally, as the handler always did.
+type RenewalPayload struct {
+	// Only run if the certificate of the config, identified by its first
+	// domain, has this identifier
+	Identifier string `json:"identifier,omitempty"`
+	// Renew even if the stored certificate is not due
+	Force bool `json:"force,omitempty"`
+	// Only report whether a renewal is due: no CA is contacted and nothing
+	// is saved or deployed
+	DryRun bool `json:"dry_run,omitempty"`
+	// Domains requested instead of those of the config
+	Domains []string `json:"domains,omitempty"`
+}
+
+// ParseRenewalPayload decodes the payload of job, nil if it has none.
+// Unknown fields are rejected so a misspelled parameter does not silently
+// renew the whole config.
+func ParseRenewalPayload(job db.Job) (*RenewalPayload, error) {
+	data := bytes.TrimSpace(job.Payload)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p RenewalPayload
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid renewal job payload %s: %w", data, err)
+	}
+	return &p, nil
+}
+
+// Marshal returns p as a job payload.
+func (p RenewalPayload) Marshal() (json.RawMessage, error) {
+	return json.Marshal(p)
+}
+
+// apply returns cfg with the Domains of p, failing if p targets another
+// certificate.
+func (p *RenewalPayload) apply(cfg *Config) (*Config, error) {
+	if p == nil {
+		return cfg, nil
+	}
+	if len(p.Domains) > 0 && !slices.Equal(p.Domains, cfg.Domains) {
+		override := *cfg
+		override.Domains = p.Domains
+		cfg = &override
+	}
+	if p.Identifier != "" && (len(cfg.Domains) == 0 || cfg.Domains[0] != p.Identifier) {
+		return nil, certNotFound("renewal job targets certificate '%s', the config renews %v", p.Identifier, cfg.Domains)
+	}
+	return cfg, nil
+}
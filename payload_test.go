@@ -0,0 +1,28 @@
+package acme
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caasmo/restinpieces/db"
+)
+
+// A payload job on a database without a stored certificate is due and
+// issues the first one.
+func TestRenewPayloadWithoutStoredCertificate(t *testing.T) {
+	store := newTestStore(t)
+	r := newTestRenewer(t, store)
+	r.SetConfig(&Config{Domains: []string{"example.com"}, IssuanceMode: IssuanceModeDev})
+
+	result, err := r.Renew(context.Background(), db.Job{Payload: []byte(`{"identifier": "example.com"}`)})
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if !result.Renewed || result.Cert == nil {
+		t.Fatalf("Renew() = %+v; want a renewed certificate", result)
+	}
+	stored, err := r.stored("example.com")
+	if err != nil || stored == nil {
+		t.Fatalf("stored() = %v, %v; want the issued certificate", stored, err)
+	}
+}
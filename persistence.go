@@ -0,0 +1,83 @@
+package acme
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Values of Config.Persistence, choosing where the handler saves the
+// certificates it obtains or revokes.
+const (
+	// PersistenceSecureStore saves to the acme_certificate scope of the
+	// SecureStore only (the default).
+	PersistenceSecureStore = "securestore"
+	// PersistenceWriter saves through the Writer set with SetWriter only,
+	// e.g. a certificates table of the application.
+	PersistenceWriter = "writer"
+	// PersistenceBoth saves to the SecureStore, then through the Writer.
+	PersistenceBoth = "both"
+)
+
+// SetWriter makes the handler also save certificates through w when the
+// Persistence of the config is PersistenceWriter or PersistenceBoth. If w is
+// a Reader, PersistenceWriter also reads the previous certificates from it.
+func (h *Renewer) SetWriter(w Writer) {
+	h.extraWriter = w
+}
+
+// validatePersistence checks that Persistence is one of the supported
+// values.
+func (c *Config) validatePersistence() error {
+	switch c.Persistence {
+	case "", PersistenceSecureStore, PersistenceWriter, PersistenceBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown Persistence '%s' in ACME config (supported: %s, %s or %s)", c.Persistence, PersistenceSecureStore, PersistenceWriter, PersistenceBoth)
+}
+
+// certWriter returns the Writer the Persistence of the config of h selects.
+func (h *Renewer) certWriter() (Writer, error) {
+	switch h.config.Persistence {
+	case PersistenceWriter, PersistenceBoth:
+		if h.extraWriter == nil {
+			return nil, classify(ErrConfigInvalid, fmt.Errorf("ACME config Persistence '%s' needs a Writer (see SetWriter)", h.config.Persistence))
+		}
+		if h.config.Persistence == PersistenceWriter {
+			return h.extraWriter, nil
+		}
+		return bothWriter{store: h.writer, writer: h.extraWriter, logger: h.logger}, nil
+	}
+	return h.writer, nil
+}
+
+// certReader returns the Reader of the certificates saved with the
+// Persistence of the config of h: the SecureStore unless it is
+// PersistenceWriter. ok is false if the certificates cannot be read back.
+func (h *Renewer) certReader() (r Reader, ok bool) {
+	if h.config.Persistence == PersistenceWriter {
+		r, ok = h.extraWriter.(Reader)
+		return r, ok
+	}
+	r, ok = h.writer.(Reader)
+	return r, ok
+}
+
+// bothWriter saves to the SecureStore, the source of truth, then through
+// the Writer of SetWriter. Once the SecureStore has the certificate the
+// renewal succeeded: a failing Writer is logged, as failing the job would
+// make a retry order a certificate that is already stored.
+type bothWriter struct {
+	store  Writer
+	writer Writer
+	logger *slog.Logger
+}
+
+func (w bothWriter) AddCert(cert Cert) error {
+	if err := w.store.AddCert(cert); err != nil {
+		return err
+	}
+	if err := w.writer.AddCert(cert); err != nil {
+		w.logger.Error("Certificate was saved to the secure store but not through the Writer", "identifier", cert.Identifier, "error", err)
+	}
+	return nil
+}
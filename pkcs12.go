@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// ScopeAcmePKCS12 is the scope of the PKCS#12 bundles stored by a PKCS12
+// output with Store set.
+const ScopeAcmePKCS12 = "acme_pkcs12"
+
+// PKCS12Output configures a passphrase protected PKCS#12 bundle produced on
+// every renewal, for Windows/IIS and Java consumers. The bundle is written to
+// Path, stored in ScopeAcmePKCS12, or both.
+type PKCS12Output struct {
+	Passphrase string
+	Path       string `toml:",omitempty"`
+	Mode       string `toml:",omitempty"` // octal, default "0600"
+	Owner      string `toml:",omitempty"` // "user" or "user:group"
+	Store      bool   `toml:",omitempty"`
+}
+
+func (p PKCS12Output) enabled() bool {
+	return p.Path != "" || p.Store
+}
+
+// pkcs12Deployer produces the bundle configured in PKCS12Output.
+type pkcs12Deployer struct {
+	output PKCS12Output
+	store  config.SecureStore
+}
+
+func (d pkcs12Deployer) name() string { return "pkcs12" }
+
+func (d pkcs12Deployer) deploy(ctx context.Context, cert *Cert) error {
+	if d.output.Passphrase == "" {
+		return fmt.Errorf("PKCS12.Passphrase is required")
+	}
+	data, err := cert.PKCS12(d.output.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	if d.output.Path != "" {
+		perm, err := parseFileMode(d.output.Mode, "PKCS12.Mode")
+		if err != nil {
+			return err
+		}
+		uid, gid, err := lookupOwner(d.output.Owner)
+		if err != nil {
+			return err
+		}
+		if err := WriteFileAtomic(d.output.Path, data, perm, uid, gid); err != nil {
+			return err
+		}
+	}
+	if d.output.Store {
+		description := fmt.Sprintf("PKCS#12 bundle (identifier: %s, expires %s)", cert.Identifier, cert.ExpiresAt.Format("2006-01-02"))
+		if err := d.store.Save(ScopeAcmePKCS12, data, "pkcs12", description); err != nil {
+			return fmt.Errorf("failed to save PKCS#12 bundle to scope '%s': %w", ScopeAcmePKCS12, err)
+		}
+	}
+	return nil
+}
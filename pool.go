@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"runtime"
+	"time"
+
+	"github.com/caasmo/restinpieces/migrations"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// DefaultBusyTimeout is how long a connection waits on a locked database
+// before failing with SQLITE_BUSY.
+const DefaultBusyTimeout = 5 * time.Second
+
+// PoolConfig tunes how NewPool opens the database. The zero value opens it
+// read-write with DefaultBusyTimeout and one connection per CPU.
+type PoolConfig struct {
+	// BusyTimeout is how long to wait for locks held by other processes.
+	BusyTimeout time.Duration
+	// PoolSize is the number of connections.
+	PoolSize int
+	// ReadOnly opens the database with SQLITE_OPEN_READONLY. Read-only
+	// connections never take write locks, so they do not contend with a
+	// running application, and the database file is never created.
+	ReadOnly bool
+}
+
+// NewPool opens a zombiezen pool suitable for sharing the database with a
+// running restinpieces application. Read-write connections are opened in WAL
+// mode, and all connections wait up to the busy timeout for locks held by the
+// application instead of failing immediately.
+func NewPool(dbPath string, cfg PoolConfig) (*sqlitex.Pool, error) {
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+	poolSize := cfg.PoolSize
+	if poolSize == 0 {
+		poolSize = runtime.NumCPU()
+	}
+
+	// Switching to WAL is a write, so read-only connections use whatever
+	// journal mode the application set.
+	flags := sqlite.OpenReadWrite | sqlite.OpenCreate | sqlite.OpenWAL | sqlite.OpenURI
+	if cfg.ReadOnly {
+		flags = sqlite.OpenReadOnly | sqlite.OpenURI
+	}
+
+	// Escaped, so '?' or '#' in the path are not read as URI parameters.
+	pool, err := sqlitex.NewPool("file:"+url.PathEscape(dbPath), sqlitex.PoolOptions{
+		Flags:    flags,
+		PoolSize: poolSize,
+		PrepareConn: func(conn *sqlite.Conn) error {
+			conn.SetBusyTimeout(busyTimeout)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zombiezen pool at %s: %w", dbPath, err)
+	}
+	return pool, nil
+}
+
+// NewMemoryPool opens a private in-memory database with the restinpieces
+// schema (app_config and the other tables of its migrations) already
+// created, for storage tests of packages built on this one without temp
+// files:
+//
+//	pool, err := acme.NewMemoryPool(t.Name())
+//	db, err := dbz.New(pool)
+//
+// The connections share the database through SQLite's shared cache, which
+// serializes their writes. Pools opened with the same name share the
+// database, so parallel tests have to use distinct names. The database is
+// dropped when the pool is closed.
+func NewMemoryPool(name string) (*sqlitex.Pool, error) {
+	uri := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(name))
+	pool, err := sqlitex.NewPool(uri, sqlitex.PoolOptions{
+		Flags:    sqlite.OpenReadWrite | sqlite.OpenCreate | sqlite.OpenURI | sqlite.OpenSharedCache,
+		PoolSize: runtime.NumCPU(),
+		PrepareConn: func(conn *sqlite.Conn) error {
+			conn.SetBusyTimeout(DefaultBusyTimeout)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-memory zombiezen pool %s: %w", name, err)
+	}
+	if err := createSchema(pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// createSchema applies the embedded restinpieces migrations.
+func createSchema(pool *sqlitex.Pool) error {
+	conn, err := pool.Take(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get db connection: %w", err)
+	}
+	defer pool.Put(conn)
+
+	schema := migrations.Schema()
+	files, err := fs.ReadDir(schema, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+	for _, f := range files {
+		if path.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		script, err := fs.ReadFile(schema, f.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", f.Name(), err)
+		}
+		if err := sqlitex.ExecuteScript(conn, string(script), nil); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", f.Name(), err)
+		}
+	}
+	return nil
+}
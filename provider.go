@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+)
+
+// DefaultProviderInterval is how often CertificateProvider.Run re-checks the
+// store when given no interval.
+const DefaultProviderInterval = time.Minute
+
+// CertificateProvider serves the certificates of a SecureCertStore to
+// crypto/tls and hot-swaps them when new ones are stored, without restarting
+// the listener:
+//
+//	p, err := acme.NewCertificateProvider(store, "", logger)
+//	go p.Run(ctx, 0)
+//	srv.TLSConfig = &tls.Config{GetCertificate: p.GetCertificate}
+//
+// The latest certificate of every stored identifier is loaded, so one
+// server can serve several domains. The certificate is selected by the SNI
+// server name, exact names taking precedence over wildcards.
+type CertificateProvider struct {
+	certs  *SecureCertStore
+	logger *slog.Logger
+
+	mu sync.RWMutex
+	// byName maps each lower-cased domain, including "*.example.com"
+	// wildcards, to the certificate covering it.
+	byName map[string]*tls.Certificate
+	// fallback is served to clients without SNI or with an unknown name: the
+	// most recently stored certificate.
+	fallback     *tls.Certificate
+	fingerprints string
+}
+
+// NewCertificateProvider loads the certificates of scope (an empty scope
+// uses ScopeAcmeCertificate) and fails if there is none usable.
+func NewCertificateProvider(store config.SecureStore, scope string, logger *slog.Logger) (*CertificateProvider, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("NewCertificateProvider: received nil logger")
+	}
+	certs, err := NewSecureCertStore(store, scope)
+	if err != nil {
+		return nil, err
+	}
+	p := &CertificateProvider{
+		certs:  certs,
+		logger: logger.With("component", "certificate_provider"),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetCertificate returns the cached certificate for the requested server
+// name. It has the signature of tls.Config.GetCertificate.
+func (p *CertificateProvider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if hello == nil || hello.ServerName == "" {
+		return p.fallback, nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if c, ok := p.byName[name]; ok {
+		return c, nil
+	}
+	// A wildcard covers exactly one label.
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if c, ok := p.byName["*."+parent]; ok {
+			return c, nil
+		}
+	}
+	return p.fallback, nil
+}
+
+// Reload re-reads the store and swaps in the latest certificates if any
+// changed. It can be called on a notification, e.g. from a RenewHook or a
+// SIGHUP handler. On error the cached certificates keep being served.
+func (p *CertificateProvider) Reload() error {
+	stored, err := p.certs.Current()
+	if err != nil {
+		return fmt.Errorf("failed to load certificates from scope '%s': %w", p.certs.Scope(), err)
+	}
+	if len(stored) == 0 {
+		return fmt.Errorf("no unrevoked certificate in scope '%s'", p.certs.Scope())
+	}
+
+	fingerprints := make([]string, len(stored))
+	for i, c := range stored {
+		fingerprints[i] = c.FingerprintSHA256
+	}
+	joined := strings.Join(fingerprints, ",")
+	p.mu.RLock()
+	unchanged := joined == p.fingerprints
+	p.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	byName := make(map[string]*tls.Certificate)
+	var fallback *tls.Certificate
+	// Oldest first, so a newer certificate wins a name both cover.
+	for i := len(stored) - 1; i >= 0; i-- {
+		c := stored[i]
+		keyPair, err := tls.X509KeyPair([]byte(c.CertificateChain), []byte(c.PrivateKey))
+		if err != nil {
+			p.logger.Error("Skipping unusable stored certificate", "identifier", c.Identifier, "error", err)
+			continue
+		}
+		for _, domain := range c.Domains {
+			byName[strings.ToLower(domain)] = &keyPair
+		}
+		fallback = &keyPair
+		p.logger.Info("Loaded certificate", "identifier", c.Identifier, "domains", c.Domains, "expires_at", c.ExpiresAt, "fingerprint_sha256", c.FingerprintSHA256)
+	}
+	if fallback == nil {
+		return fmt.Errorf("no usable certificate in scope '%s'", p.certs.Scope())
+	}
+
+	p.mu.Lock()
+	p.byName = byName
+	p.fallback = fallback
+	p.fingerprints = joined
+	p.mu.Unlock()
+	return nil
+}
+
+// Run calls Reload every interval (DefaultProviderInterval if zero) until
+// ctx is done. Failures are logged and the cached certificates are kept.
+func (p *CertificateProvider) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultProviderInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(); err != nil {
+				p.logger.Error("Failed to reload certificates, keeping the current ones", "error", err)
+			}
+		}
+	}
+}
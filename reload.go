@@ -0,0 +1,70 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DefaultReloadSignal is sent by Reload when no Signal is configured.
+const DefaultReloadSignal = "HUP"
+
+// Reload tells a running server to pick up the renewed certificate, without
+// the need for a RenewHook in the common cases. Either a signal is sent to
+// PID or to the process in PIDFile, or `systemctl reload SystemdUnit` is run.
+type Reload struct {
+	Signal      string `toml:",omitempty"` // e.g. "HUP" or "USR1", "SIG" prefix optional (default "HUP")
+	PID         int    `toml:",omitempty"`
+	PIDFile     string `toml:",omitempty"`
+	SystemdUnit string `toml:",omitempty"`
+}
+
+func (r Reload) enabled() bool {
+	return r.PID != 0 || r.PIDFile != "" || r.SystemdUnit != ""
+}
+
+// reload runs the configured reload action.
+func (h *Renewer) reload(ctx context.Context) error {
+	r := h.config.Reload
+	if r.SystemdUnit != "" {
+		h.logger.Info("Reloading systemd unit", "unit", r.SystemdUnit)
+		out, err := exec.CommandContext(ctx, "systemctl", "reload", r.SystemdUnit).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("systemctl reload %s failed: %w: %s", r.SystemdUnit, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	name := r.Signal
+	if name == "" {
+		name = DefaultReloadSignal
+	}
+	sig, ok := reloadSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return fmt.Errorf("unsupported Reload.Signal '%s' on this platform", r.Signal)
+	}
+
+	pid := r.PID
+	if r.PIDFile != "" {
+		data, err := os.ReadFile(r.PIDFile)
+		if err != nil {
+			return fmt.Errorf("failed to read pidfile: %w", err)
+		}
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil || pid <= 0 {
+			return fmt.Errorf("pidfile %s does not contain a valid PID", r.PIDFile)
+		}
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", pid, err)
+	}
+	h.logger.Info("Signaling process to reload", "pid", pid, "signal", sig)
+	if err := proc.Signal(sig); err != nil {
+		return fmt.Errorf("failed to send %s to process %d: %w", sig, pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package acme
+
+import "os"
+
+// reloadSignals is empty where processes cannot be signaled to reload; only
+// Reload.SystemdUnit is meaningful there.
+var reloadSignals = map[string]os.Signal{}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package acme
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals maps Reload.Signal names, without the "SIG" prefix, to
+// signals.
+var reloadSignals = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
@@ -0,0 +1,32 @@
+package acme
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DefaultRenewalThreshold is the remaining validity below which a
+// certificate is renewed. Let's Encrypt recommends renewing 30 days before
+// expiry of its 90-day certificates.
+const DefaultRenewalThreshold = 30 * 24 * time.Hour
+
+// RenewalDue reports whether stored has to be replaced by a new certificate
+// for domains, and why. A nil stored certificate is always due, as is a
+// self-signed bootstrap certificate.
+func RenewalDue(stored *Cert, domains []string, threshold time.Duration, now time.Time) (bool, string) {
+	switch {
+	case stored == nil:
+		return true, "no certificate stored"
+	case !stored.RevokedAt.IsZero():
+		return true, "stored certificate was revoked"
+	case stored.SelfSigned:
+		return true, "stored certificate is a self-signed bootstrap certificate"
+	case !slices.Equal(stored.Domains, domains):
+		return true, fmt.Sprintf("configured domains %v differ from stored %v", domains, stored.Domains)
+	case stored.ExpiresAt.Sub(now) < threshold:
+		return true, fmt.Sprintf("expires %s, within the renewal threshold of %s", stored.ExpiresAt.Format(time.RFC3339), threshold)
+	default:
+		return false, fmt.Sprintf("valid until %s", stored.ExpiresAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,162 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+)
+
+// Renewer obtains, checks and revokes the certificate of a Config, saving
+// it to the acme_certificate scope of a SecureStore. It is the engine of
+// CertRenewalHandler, usable without the restinpieces job queue:
+//
+//	r, err := acme.NewRenewer(cfg, store, logger)
+//	if due, err := r.NeedsRenewal(ctx); err == nil && due {
+//		cert, err := r.ObtainCertificate(ctx)
+//	}
+//
+// Renew runs a job as the handler does and returns its RenewalResult.
+//
+// The Set* methods (SetMetrics, SetEventSink, SetClock, SetClientFactory,
+// SetLegoLogger, SetWriter) and AddObserver configure it like the handler.
+type Renewer struct {
+	config            *Config     // config of this run, see current
+	live              *liveConfig // latest config, see SetConfig
+	pinned            bool        // set by PinConfig
+	secureConfigStore config.SecureStore
+	writer            Writer // the acme_certificate scope, see certWriter
+	extraWriter       Writer // set by SetWriter
+	logger            *slog.Logger
+	legoLogger        *slog.Logger // lego's lines during runs, see SetLegoLogger
+	metrics           *Metrics     // nil unless SetMetrics was called
+	events            EventSink    // nil unless SetEventSink was called
+	clock             Clock
+	newClient         ClientFactory
+	observers         []RenewalObserver // added with AddObserver
+}
+
+// NewRenewer returns a Renewer for cfg saving to store, applying
+// SetDefaults to cfg. It fails if any argument is nil.
+func NewRenewer(cfg *Config, store config.SecureStore, logger *slog.Logger) (*Renewer, error) {
+	if cfg == nil || store == nil || logger == nil {
+		return nil, fmt.Errorf("NewRenewer: received nil config, store, or logger")
+	}
+	cfg.SetDefaults()
+	r := &Renewer{
+		config:            cfg,
+		live:              new(liveConfig),
+		secureConfigStore: store,
+		writer:            newSecureCertStore(store, ScopeAcmeCertificate),
+		logger:            logger,
+		legoLogger:        logger.With("component", "lego"),
+		clock:             SystemClock{},
+		newClient:         defaultClientFactory(store),
+	}
+	r.live.Store(cfg)
+	installLegoRouter(r.logger)
+	return r, nil
+}
+
+// SetLegoLogger makes the lines lego logs for the domains of h while h
+// obtains or revokes a certificate go to logger, with a component=lego
+// attribute, instead of the process-wide logger of the package-level
+// SetLegoLogger. By default they go to the logger of h.
+func (h *Renewer) SetLegoLogger(logger *slog.Logger) {
+	h.legoLogger = logger.With("component", "lego")
+}
+
+// withLegoLogs routes lego's lines for the domains of cfg to the lego logger
+// of h until the returned function is called.
+func (h *Renewer) withLegoLogs(cfg *Config) func() {
+	run := legoLogs.begin(h.legoLogger, cfg.Domains)
+	return func() { legoLogs.end(run) }
+}
+
+// ObtainCertificate obtains a new certificate, saves it and deploys it to
+// the targets of the config, as one run of the job handler does. A failed
+// deployment does not fail it; it is logged and reported to the observers.
+func (h *Renewer) ObtainCertificate(ctx context.Context) (*Cert, error) {
+	result, err := h.Renew(ctx, db.Job{})
+	return result.Cert, err
+}
+
+// NeedsRenewal reports whether the stored certificate of the config has to
+// be replaced (see RenewalDue, with the RenewalThreshold of the config). A
+// missing certificate needs renewal.
+func (h *Renewer) NeedsRenewal(ctx context.Context) (bool, error) {
+	h = h.current()
+	if len(h.config.Domains) == 0 {
+		return false, classify(ErrConfigInvalid, fmt.Errorf("ACME config has no Domains"))
+	}
+	due, reason, err := h.due(h.config)
+	if err != nil {
+		return false, err
+	}
+	h.logger.Debug("Checked renewal", "identifier", h.config.Domains[0], "due", due, "reason", reason)
+	return due, nil
+}
+
+// due reports whether the stored certificate of cfg, which must have
+// Domains, has to be replaced, and why.
+func (h *Renewer) due(cfg *Config) (bool, string, error) {
+	threshold, err := cfg.renewalThreshold()
+	if err != nil {
+		return false, "", classify(ErrConfigInvalid, err)
+	}
+	stored, err := h.stored(cfg.Domains[0])
+	if err != nil {
+		return false, "", err
+	}
+	due, reason := RenewalDue(stored, cfg.Domains, threshold, h.clock.Now())
+	return due, reason, nil
+}
+
+// Revoke revokes the stored certificate of the config at the CA with an
+// RFC 5280 reason code and records the revocation as a new version.
+func (h *Renewer) Revoke(ctx context.Context, reason uint) error {
+	h = h.current()
+	if len(h.config.Domains) == 0 {
+		return classify(ErrConfigInvalid, fmt.Errorf("ACME config has no Domains"))
+	}
+	stored, err := h.stored(h.config.Domains[0])
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return certNotFound("no certificate with identifier '%s' to revoke", h.config.Domains[0])
+	}
+	if !stored.RevokedAt.IsZero() {
+		return fmt.Errorf("certificate '%s' (serial %s) was already revoked at %s", stored.Identifier, stored.SerialNumber, stored.RevokedAt)
+	}
+
+	if err := h.revoke(stored, reason); err != nil {
+		return err
+	}
+	// The store is append-only: record the revocation as a new version.
+	writer, err := h.certWriter()
+	if err != nil {
+		return err
+	}
+	if err := writer.AddCert(*stored); err != nil {
+		return fmt.Errorf("certificate was revoked at the CA but recording it failed: %w", err)
+	}
+	return nil
+}
+
+// stored returns the latest stored certificate with identifier, nil if
+// there is none.
+func (h *Renewer) stored(identifier string) (*Cert, error) {
+	r, ok := h.certReader()
+	if !ok {
+		return nil, nil
+	}
+	c, err := r.ByIdentifier(identifier)
+	if errors.Is(err, ErrCertNotFound) {
+		return nil, nil
+	}
+	return c, err
+}
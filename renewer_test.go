@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/caasmo/restinpieces/config"
+	dbz "github.com/caasmo/restinpieces/db/zombiezen"
+)
+
+// newTestStore returns an age SecureStore on a fresh in-memory database.
+func newTestStore(t *testing.T) config.SecureStore {
+	t.Helper()
+	pool, err := NewMemoryPool(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	dbImpl, err := dbz.New(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "age.key")
+	if err := os.WriteFile(keyPath, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSecureStore(dbImpl, keyPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newTestRenewer(t *testing.T, store config.SecureStore) *Renewer {
+	t.Helper()
+	r, err := NewRenewer(&Config{Domains: []string{"example.com"}}, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestNeedsRenewalWithoutStoredCertificate(t *testing.T) {
+	r := newTestRenewer(t, newTestStore(t))
+	due, err := r.NeedsRenewal(context.Background())
+	if err != nil || !due {
+		t.Fatalf("NeedsRenewal() = %v, %v; want true, nil", due, err)
+	}
+}
+
+func TestHistoryOfEmptyScope(t *testing.T) {
+	certs, err := newSecureCertStore(newTestStore(t), ScopeAcmeCertificate).History()
+	if err != nil || len(certs) != 0 {
+		t.Fatalf("History() = %v, %v; want no certificates, nil", certs, err)
+	}
+}
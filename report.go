@@ -0,0 +1,249 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+)
+
+// ExpiryReport summarizes the stored certificates for an ops list: days to
+// expiry, the outcome of the last renewal and when renewal is next due.
+type ExpiryReport struct {
+	GeneratedAt  time.Time     `json:"generated_at"`
+	Threshold    string        `json:"renewal_threshold"`
+	Certificates []ReportEntry `json:"certificates"`
+}
+
+// ReportEntry is the newest stored certificate of one identifier, soonest
+// expiry first in an ExpiryReport.
+type ReportEntry struct {
+	Identifier    string    `json:"identifier"`
+	Domains       []string  `json:"domains"`
+	IssuedAt      time.Time `json:"issued_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	DaysRemaining int       `json:"days_remaining"`
+	Revoked       bool      `json:"revoked"`
+	RenewalDue    bool      `json:"renewal_due"`
+	Status        string    `json:"status"`   // "ok", "renewal due", "expired" or "revoked"
+	RenewAt       time.Time `json:"renew_at"` // when the renewal threshold is reached
+	// Outcome of the last certificate order: "succeeded", "failed" or
+	// "unknown" when no RenewalTimings were saved for the identifier.
+	LastRenewal   string    `json:"last_renewal"`
+	LastRenewalAt time.Time `json:"last_renewal_at,omitzero"`
+	LastError     string    `json:"last_error,omitempty"` // from the AlertState, if Alerting is enabled
+}
+
+// BuildExpiryReport reads the certificates, the last RenewalTimings and the
+// AlertState from store. Renewal is due as decided by RenewalDue with
+// threshold.
+func BuildExpiryReport(store config.SecureStore, threshold time.Duration, now time.Time) (*ExpiryReport, error) {
+	certs, err := newSecureCertStore(store, ScopeAcmeCertificate).History()
+	if err != nil {
+		return nil, err
+	}
+	timings, err := LastRenewalTimings(store)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := LoadAlertState(store)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExpiryReport{GeneratedAt: now.UTC(), Threshold: threshold.String(), Certificates: []ReportEntry{}}
+	seen := make(map[string]bool)
+	for i := range certs {
+		c := &certs[i]
+		if seen[c.Identifier] {
+			continue
+		}
+		seen[c.Identifier] = true
+
+		due, _ := RenewalDue(c, c.Domains, threshold, now)
+		e := ReportEntry{
+			Identifier:    c.Identifier,
+			Domains:       c.Domains,
+			IssuedAt:      c.IssuedAt,
+			ExpiresAt:     c.ExpiresAt,
+			DaysRemaining: int(c.ExpiresAt.Sub(now).Hours() / 24),
+			Revoked:       !c.RevokedAt.IsZero(),
+			RenewalDue:    due,
+			RenewAt:       c.ExpiresAt.Add(-threshold),
+			LastRenewal:   "unknown",
+		}
+		if timings != nil && timings.Identifier == c.Identifier {
+			e.LastRenewal = "failed"
+			if timings.Succeeded {
+				e.LastRenewal = "succeeded"
+			}
+			e.LastRenewalAt = timings.At
+		}
+		e.Status = e.status()
+		if alerts.Identifier == c.Identifier && alerts.ConsecutiveFailures > 0 {
+			e.LastError = alerts.LastError
+		}
+		report.Certificates = append(report.Certificates, e)
+	}
+	sort.SliceStable(report.Certificates, func(i, j int) bool {
+		return report.Certificates[i].ExpiresAt.Before(report.Certificates[j].ExpiresAt)
+	})
+	return report, nil
+}
+
+// Subject returns a one-line summary for the report email.
+func (r *ExpiryReport) Subject() string {
+	due := 0
+	for _, e := range r.Certificates {
+		if e.RenewalDue || e.LastRenewal == "failed" {
+			due++
+		}
+	}
+	if due == 0 {
+		return fmt.Sprintf("Certificate report: %d certificates, all current", len(r.Certificates))
+	}
+	return fmt.Sprintf("Certificate report: %d of %d certificates need attention", due, len(r.Certificates))
+}
+
+// WriteText writes the report as an aligned plain text table.
+func (r *ExpiryReport) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Certificate report generated %s (renewal threshold %s)\n\n", r.GeneratedAt.Format(time.RFC3339), r.Threshold)
+	if len(r.Certificates) == 0 {
+		fmt.Fprintln(&buf, "No certificates stored.")
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IDENTIFIER\tEXPIRES\tDAYS\tRENEW AT\tSTATUS\tLAST RENEWAL")
+	for _, e := range r.Certificates {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			e.Identifier, e.ExpiresAt.Format("2006-01-02"), e.DaysRemaining,
+			e.RenewAt.Format("2006-01-02"), e.Status, e.lastRenewal())
+	}
+	tw.Flush()
+	for _, e := range r.Certificates {
+		if e.LastError != "" {
+			fmt.Fprintf(&buf, "\n%s last error: %s\n", e.Identifier, e.LastError)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><body>
+<h2>Certificate report</h2>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}, renewal threshold {{.Threshold}}.</p>
+{{if .Certificates}}<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Identifier</th><th>Domains</th><th>Expires</th><th>Days</th><th>Renew at</th><th>Status</th><th>Last renewal</th></tr>
+{{range .Certificates}}<tr>
+<td>{{.Identifier}}</td><td>{{range $i, $d := .Domains}}{{if $i}}, {{end}}{{$d}}{{end}}</td>
+<td>{{.ExpiresAt.Format "2006-01-02"}}</td><td>{{.DaysRemaining}}</td><td>{{.RenewAt.Format "2006-01-02"}}</td>
+<td>{{.Status}}</td><td>{{.LastRenewal}}{{if not .LastRenewalAt.IsZero}} {{.LastRenewalAt.Format "2006-01-02"}}{{end}}{{if .LastError}}<br><small>{{.LastError}}</small>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>No certificates stored.</p>{{end}}
+</body></html>
+`))
+
+// WriteHTML writes the report as an HTML page suitable for an email body.
+func (r *ExpiryReport) WriteHTML(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := reportHTML.Execute(&buf, r); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (e ReportEntry) status() string {
+	switch {
+	case e.Revoked:
+		return "revoked"
+	case e.DaysRemaining < 0:
+		return "expired"
+	case e.RenewalDue:
+		return "renewal due"
+	default:
+		return "ok"
+	}
+}
+
+func (e ReportEntry) lastRenewal() string {
+	if e.LastRenewalAt.IsZero() {
+		return e.LastRenewal
+	}
+	return fmt.Sprintf("%s %s", e.LastRenewal, e.LastRenewalAt.Format("2006-01-02"))
+}
+
+// ExpiryReportConfig emails an ExpiryReport whenever the report job runs.
+// It is sent through the SMTP server of EmailNotification.
+type ExpiryReportConfig struct {
+	To   []string
+	HTML bool `toml:",omitempty"` // Add an HTML part to the plain text one
+}
+
+// ReportHandler is a restinpieces job handler emailing the ExpiryReport to
+// Config.ExpiryReport.To, e.g. registered for a weekly recurrent job.
+type ReportHandler struct {
+	config            *Config
+	secureConfigStore config.SecureStore
+	logger            *slog.Logger
+	clock             Clock
+}
+
+// NewReportHandler returns the handler emailing the report of the
+// certificates in store. It fails if any argument is nil.
+func NewReportHandler(cfg *Config, store config.SecureStore, logger *slog.Logger) (*ReportHandler, error) {
+	if cfg == nil || store == nil || logger == nil {
+		return nil, fmt.Errorf("NewReportHandler: received nil config, store, or logger")
+	}
+	return &ReportHandler{
+		config:            cfg,
+		secureConfigStore: store,
+		logger:            logger.With("job_handler", "cert_report"),
+		clock:             SystemClock{},
+	}, nil
+}
+
+// SetClock makes the handler read the time from c instead of the system.
+func (h *ReportHandler) SetClock(c Clock) {
+	h.clock = c
+}
+
+// Handle builds the report and emails it.
+func (h *ReportHandler) Handle(ctx context.Context, job db.Job) error {
+	rc := h.config.ExpiryReport
+	if len(rc.To) == 0 {
+		return fmt.Errorf("ExpiryReport.To has no recipients")
+	}
+	report, err := BuildExpiryReport(h.secureConfigStore, DefaultRenewalThreshold, h.clock.Now())
+	if err != nil {
+		h.logger.Error("Failed to build certificate report", "error", err)
+		return err
+	}
+
+	var plain, html bytes.Buffer
+	if err := report.WriteText(&plain); err != nil {
+		return err
+	}
+	if rc.HTML {
+		if err := report.WriteHTML(&html); err != nil {
+			return err
+		}
+	}
+	if err := sendEmail(ctx, h.secureConfigStore, h.config.EmailNotification.Smtp, rc.To, report.Subject(), plain.String(), html.String()); err != nil {
+		h.logger.Error("Failed to send certificate report", "to", rc.To, "error", err)
+		return fmt.Errorf("failed to send certificate report: %w", err)
+	}
+	h.logger.Info("Sent certificate report", "to", rc.To, "certificates", len(report.Certificates))
+	return nil
+}
@@ -0,0 +1,101 @@
+package acme
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ScopeAcmeResults is the scope of the RenewalResult saved by the handler
+// after each job.
+const ScopeAcmeResults = "acme_results"
+
+// RenewalResult is what one run of Renewer.Renew did, so callers need not
+// re-read the store to learn it. Renewed is set once a new certificate was
+// saved, even if its deployment failed afterwards (see DeployError).
+type RenewalResult struct {
+	Identifier string
+	Domains    []string
+	StartedAt  time.Time // UTC
+	// Whole run, from the payload check to the deployment, in seconds
+	DurationSeconds float64
+	Renewed         bool
+	// Set when the payload only asked whether a renewal is due
+	DryRun bool `toml:",omitempty"`
+	// RenewalDue reason of a run that checked it, e.g. why nothing was
+	// renewed
+	Reason            string    `toml:",omitempty"`
+	ExpiresAt         time.Time `toml:",omitempty"` // of the new certificate
+	FingerprintSHA256 string    `toml:",omitempty"`
+	CertURL           string    `toml:",omitempty"` // at the CA
+	Error             string    `toml:",omitempty"`
+	// Deployment failure after the certificate was saved, which does not
+	// fail the run (see DeploymentReport for the failing targets)
+	DeployError string `toml:",omitempty"`
+
+	// The saved certificate, not persisted with the result
+	Cert *Cert `toml:"-"`
+}
+
+// Duration returns DurationSeconds as a time.Duration.
+func (r *RenewalResult) Duration() time.Duration {
+	return secondsDuration(r.DurationSeconds)
+}
+
+// recordResult logs and saves the result of a job. Failures to save are
+// logged, they never change the outcome of the job.
+func (h *Renewer) recordResult(r *RenewalResult) {
+	h.logger.Info("Renewal result",
+		"identifier", r.Identifier,
+		"renewed", r.Renewed,
+		"dry_run", r.DryRun,
+		"reason", r.Reason,
+		"expires_at", r.ExpiresAt,
+		"cert_url", r.CertURL,
+		"duration", r.Duration(),
+		"error", r.Error)
+	if err := SaveRenewalResult(h.secureConfigStore, *r); err != nil {
+		h.logger.Error("Failed to save renewal result", "error", err)
+	}
+}
+
+// SaveRenewalResult saves r as the latest version of ScopeAcmeResults.
+func SaveRenewalResult(store CertSaver, r RenewalResult) error {
+	data, err := toml.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal renewal result: %w", err)
+	}
+	outcome := "not renewed"
+	switch {
+	case r.Error != "":
+		outcome = "failed"
+	case r.Renewed:
+		outcome = "renewed"
+	}
+	description := fmt.Sprintf("Renewal of %s %s in %s", r.Identifier, outcome, r.Duration())
+	if err := store.Save(ScopeAcmeResults, data, "toml", description); err != nil {
+		return fmt.Errorf("failed to save renewal result to scope '%s': %w", ScopeAcmeResults, err)
+	}
+	return nil
+}
+
+// LastRenewalResult returns the most recently saved RenewalResult, or nil
+// when none was saved yet.
+func LastRenewalResult(store ConfigReader) (*RenewalResult, error) {
+	data, format, err := store.Get(ScopeAcmeResults, 0)
+	if scopeEmpty(data, err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load renewal result from scope '%s': %w", ScopeAcmeResults, err)
+	}
+	if format != "toml" {
+		return nil, fmt.Errorf("renewal result in scope '%s' is in format '%s', expected 'toml'", ScopeAcmeResults, format)
+	}
+	var r RenewalResult
+	if err := toml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal renewal result: %w", err)
+	}
+	return &r, nil
+}
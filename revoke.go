@@ -0,0 +1,32 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+)
+
+// RevokeCert asks the CA of the config of h to revoke cert with the given
+// RFC 5280 reason code, authenticating with the ACME account key of the
+// config. On success cert is marked revoked; persisting that state is left to
+// the caller, Revoke does it for the latest certificate of the config.
+func (h *Renewer) RevokeCert(ctx context.Context, cert *Cert, reason uint) error {
+	return h.current().revoke(cert, reason)
+}
+
+// revoke is RevokeCert with the config of h, already resolved by current.
+func (h *Renewer) revoke(cert *Cert, reason uint) error {
+	defer h.withLegoLogs(h.config)()
+	client, err := h.newClient(h.config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Revoke([]byte(cert.CertificateChain), reason); err != nil {
+		return fmt.Errorf("failed to revoke certificate %s (serial %s): %w", cert.Identifier, cert.SerialNumber, err)
+	}
+
+	cert.RevokedAt = h.clock.Now().UTC()
+	cert.RevocationReason = reason
+	h.logger.Info("Certificate revoked", "identifier", cert.Identifier, "serial", cert.SerialNumber, "reason", reason)
+	return nil
+}
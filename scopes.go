@@ -0,0 +1,96 @@
+package acme
+
+import "github.com/caasmo/restinpieces/config"
+
+// Scopes names the SecureStore scopes the handler and the commands use. The
+// package always addresses a scope by its Scope* constant; NewScopedStore
+// maps those to the names of a Scopes, so one database can hold the state
+// of several independent configurations.
+type Scopes struct {
+	Config      string
+	Certificate string
+	Deployments string
+	Alerts      string
+	Timings     string
+	PKCS12      string
+	DevCA       string
+	Results     string
+}
+
+// DefaultScopes returns the Scope* constants.
+func DefaultScopes() Scopes {
+	return Scopes{
+		Config:      ScopeConfig,
+		Certificate: ScopeAcmeCertificate,
+		Deployments: ScopeAcmeDeployments,
+		Alerts:      ScopeAcmeAlerts,
+		Timings:     ScopeAcmeTimings,
+		PKCS12:      ScopeAcmePKCS12,
+		DevCA:       ScopeAcmeDevCA,
+		Results:     ScopeAcmeResults,
+	}
+}
+
+// WithPrefix returns s with prefix prepended to every name.
+func (s Scopes) WithPrefix(prefix string) Scopes {
+	for _, name := range s.names() {
+		*name = prefix + *name
+	}
+	return s
+}
+
+// All returns the names of s, e.g. to prune them.
+func (s Scopes) All() []string {
+	var all []string
+	for _, name := range s.names() {
+		all = append(all, *name)
+	}
+	return all
+}
+
+func (s *Scopes) names() []*string {
+	return []*string{&s.Config, &s.Certificate, &s.Deployments, &s.Alerts, &s.Timings, &s.PKCS12, &s.DevCA, &s.Results}
+}
+
+// name returns the name of the scope with the Scope* constant scope. Other
+// scopes, such as the restinpieces application config, keep their name.
+func (s Scopes) name(scope string) string {
+	defaults := DefaultScopes()
+	for i, name := range defaults.names() {
+		if *name == scope {
+			return *s.names()[i]
+		}
+	}
+	return scope
+}
+
+// scopedStore is the SecureStore of NewScopedStore.
+type scopedStore struct {
+	store  config.SecureStore
+	scopes Scopes
+}
+
+// NewScopedStore returns a SecureStore reading and writing the scopes of
+// the package under the names of scopes. Empty names keep the default.
+func NewScopedStore(store config.SecureStore, scopes Scopes) config.SecureStore {
+	return scopedStore{store: store, scopes: scopes.withDefaults()}
+}
+
+// withDefaults returns s with its empty names set to the default.
+func (s Scopes) withDefaults() Scopes {
+	defaults := DefaultScopes()
+	for i, name := range s.names() {
+		if *name == "" {
+			*name = *defaults.names()[i]
+		}
+	}
+	return s
+}
+
+func (s scopedStore) Get(scope string, generation int) ([]byte, string, error) {
+	return s.store.Get(s.scopes.name(scope), generation)
+}
+
+func (s scopedStore) Save(scope string, plaintextData []byte, format string, description string) error {
+	return s.store.Save(s.scopes.name(scope), plaintextData, format, description)
+}
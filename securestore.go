@@ -0,0 +1,194 @@
+package acme
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+	"github.com/caasmo/restinpieces/config"
+	"github.com/caasmo/restinpieces/db"
+)
+
+// NewSecureStore returns the age SecureStore of restinpieces for the identity
+// file at ageKeyPath or, when recipientsPath is set, a SecureStore that also
+// encrypts every saved version to the recipients listed in that file (see
+// ParseRecipientsFile), e.g. a team or offline backup key. Versions saved
+// before, or by the restinpieces server itself, stay readable with the
+// identity only. An identity file holding an age plugin identity
+// ("AGE-PLUGIN-..."), as written by age-plugin-yubikey or age-plugin-tpm,
+// also gets this store, as restinpieces only supports X25519 identities.
+func NewSecureStore(dbCfg db.DbConfig, ageKeyPath, recipientsPath string) (config.SecureStore, error) {
+	var recipients []age.Recipient
+	if recipientsPath != "" {
+		var err error
+		if recipients, err = ParseRecipientsFile(recipientsPath); err != nil {
+			return nil, err
+		}
+	} else {
+		usesPlugin, err := hasPluginIdentity(ageKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if !usesPlugin {
+			return config.NewSecureStoreAge(dbCfg, ageKeyPath)
+		}
+	}
+	return &multiRecipientStore{dbCfg: dbCfg, ageKeyPath: ageKeyPath, recipients: recipients}, nil
+}
+
+// ParseRecipientsFile reads age X25519 recipients ("age1..."), one per line,
+// from path. Empty lines and lines starting with # are ignored.
+func ParseRecipientsFile(path string) ([]age.Recipient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age recipients file '%s': %w", path, err)
+	}
+	recipients, err := age.ParseRecipients(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age recipients file '%s': %w", path, err)
+	}
+	return recipients, nil
+}
+
+// multiRecipientStore is the restinpieces age SecureStore with additional
+// recipients and plugin identity support. Like it, the identity file is read
+// on every call so the key material is held in memory only briefly; a
+// hardware backed plugin identity may ask for a touch or PIN on every call.
+type multiRecipientStore struct {
+	dbCfg      db.DbConfig
+	ageKeyPath string
+	recipients []age.Recipient // in addition to the one of the identity
+}
+
+// Get implements config.SecureStore.
+func (s *multiRecipientStore) Get(scope string, generation int) ([]byte, string, error) {
+	if generation < 0 {
+		return nil, "", fmt.Errorf("generation cannot be negative")
+	}
+	if scope == "" {
+		scope = config.ScopeApplication
+	}
+	encrypted, format, err := s.dbCfg.GetConfig(scope, generation)
+	if err != nil {
+		return nil, "", fmt.Errorf("securestore: failed to get config: %w", err)
+	}
+	identities, _, err := loadIdentities(s.ageKeyPath)
+	if err != nil {
+		return nil, "", err
+	}
+	decrypted, err := age.Decrypt(bytes.NewReader(encrypted), identities...)
+	if err != nil {
+		return nil, "", fmt.Errorf("securestore: decrypt failed: %w", err)
+	}
+	plaintext, err := io.ReadAll(decrypted)
+	return plaintext, format, err
+}
+
+// Save implements config.SecureStore, encrypting to the recipient of the
+// identity and to every additional recipient.
+func (s *multiRecipientStore) Save(scope string, plaintextData []byte, format string, description string) error {
+	_, own, err := loadIdentities(s.ageKeyPath)
+	if err != nil {
+		return err
+	}
+	recipients := append([]age.Recipient{own}, s.recipients...)
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return fmt.Errorf("securestore: failed to create age encryption writer for scope '%s': %w", scope, err)
+	}
+	if _, err := w.Write(plaintextData); err != nil {
+		return fmt.Errorf("securestore: failed to write data to age encryption writer for scope '%s': %w", scope, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("securestore: failed to close age encryption writer for scope '%s': %w", scope, err)
+	}
+	if err := s.dbCfg.InsertConfig(scope, buf.Bytes(), format, description); err != nil {
+		return fmt.Errorf("securestore: failed to insert config for scope '%s': %w", scope, err)
+	}
+	return nil
+}
+
+// pluginIdentityPrefix starts the encoding of age plugin identities.
+const pluginIdentityPrefix = "AGE-PLUGIN-"
+
+// loadIdentities reads and parses the age identity file, zeroing the raw key
+// material afterwards. Besides X25519 identities it accepts plugin
+// identities, run through their age-plugin-* binary on decryption. own is
+// the recipient of the first identity that versions are saved to. For a
+// plugin identity it is the "# Recipient: age1..." comment the plugins write
+// above it, or the identity itself if the comment is missing.
+func loadIdentities(keyPath string) (identities []age.Identity, own age.Recipient, err error) {
+	keyContent, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("securestore: failed to read age key file '%s': %w", keyPath, err)
+	}
+	defer Zeroize(keyContent)
+
+	var commentRecipient string
+	scanner := bufio.NewScanner(bytes.NewReader(keyContent))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			if _, r, ok := strings.Cut(line, "Recipient:"); ok {
+				commentRecipient = strings.TrimSpace(r)
+			}
+		case strings.HasPrefix(line, pluginIdentityPrefix):
+			id, err := plugin.NewIdentity(line, pluginUI)
+			if err != nil {
+				return nil, nil, fmt.Errorf("securestore: invalid plugin identity at line %d of '%s': %w", n, keyPath, err)
+			}
+			identities = append(identities, id)
+			if own == nil {
+				if own, err = pluginRecipient(id, commentRecipient); err != nil {
+					return nil, nil, fmt.Errorf("securestore: invalid recipient comment at line %d of '%s': %w", n-1, keyPath, err)
+				}
+			}
+		default:
+			id, err := age.ParseX25519Identity(line)
+			if err != nil {
+				return nil, nil, fmt.Errorf("securestore: failed to parse age identity at line %d of '%s': %w", n, keyPath, err)
+			}
+			identities = append(identities, id)
+			if own == nil {
+				own = id.Recipient()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("securestore: failed to read age key file '%s': %w", keyPath, err)
+	}
+	if len(identities) == 0 {
+		return nil, nil, fmt.Errorf("securestore: no age identities found in key file '%s'", keyPath)
+	}
+	return identities, own, nil
+}
+
+// pluginRecipient returns the recipient of a plugin identity: the one from
+// its recipient comment, or the identity itself for plugins that support
+// encrypting to identities.
+func pluginRecipient(id *plugin.Identity, comment string) (age.Recipient, error) {
+	if comment == "" {
+		return id.Recipient(), nil
+	}
+	return plugin.NewRecipient(comment, pluginUI)
+}
+
+// hasPluginIdentity reports whether the identity file at keyPath holds an
+// age plugin identity.
+func hasPluginIdentity(keyPath string) (bool, error) {
+	keyContent, err := os.ReadFile(keyPath)
+	if err != nil {
+		return false, fmt.Errorf("securestore: failed to read age key file '%s': %w", keyPath, err)
+	}
+	defer Zeroize(keyContent)
+	return bytes.Contains(keyContent, []byte(pluginIdentityPrefix)), nil
+}
@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+)
+
+// DefaultSelfSignedValidity is the lifetime of bootstrap certificates.
+const DefaultSelfSignedValidity = 7 * 24 * time.Hour
+
+// NewSelfSignedCert creates a throwaway self-signed certificate with an
+// ECDSA P-256 key for domains, valid from now for validity. It lets a new
+// server serve TLS before the first ACME issuance completes; browsers will
+// not trust it. The returned Cert has SelfSigned set, so RenewalDue always
+// replaces it. An empty identifier defaults to the first domain.
+func NewSelfSignedCert(identifier string, domains []string, validity time.Duration) (*Cert, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains given for the self-signed certificate")
+	}
+	if validity <= 0 {
+		validity = DefaultSelfSignedValidity
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	// Backdate a little to tolerate clock skew between server and clients.
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: domains[0]},
+		DNSNames:              domains,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create self-signed certificate: %w", err)
+	}
+
+	chainPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	c, err := NewCert(identifier, domains, chainPEM, certcrypto.PEMEncode(key))
+	if err != nil {
+		return nil, err
+	}
+	c.SelfSigned = true
+	return c, nil
+}
@@ -0,0 +1,170 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshDialTimeout bounds connecting and authenticating to an SSHTarget.
+const sshDialTimeout = 30 * time.Second
+
+// SSHTarget is a remote host the renewed certificate is copied to over SSH,
+// for example one of several TLS terminating frontends. Authentication is by
+// key only and the host key must be listed in KnownHostsFile.
+type SSHTarget struct {
+	Host string // host or host:port (default port 22)
+	User string
+	// PEM private key used to authenticate, stored encrypted with the rest
+	// of the config. Like AcmeAccountPrivateKey, best inserted as a TOML
+	// multiline literal string.
+	PrivateKey     string
+	KnownHostsFile string `toml:",omitempty"` // default ~/.ssh/known_hosts
+
+	// Remote paths; empty paths are skipped. Files are replaced atomically.
+	CertPath      string `toml:",omitempty"`
+	KeyPath       string `toml:",omitempty"`
+	FullchainPath string `toml:",omitempty"`
+	CombinedPath  string `toml:",omitempty"` // key + leaf + intermediates (HAProxy)
+	Mode          string `toml:",omitempty"` // octal, default "0600"
+
+	// Command run on the host after the files are copied, e.g.
+	// "sudo systemctl reload haproxy"
+	ReloadCommand string `toml:",omitempty"`
+}
+
+// sshDeployer copies the certificate to one SSHTarget.
+type sshDeployer struct {
+	target SSHTarget
+}
+
+func (d sshDeployer) name() string { return "ssh:" + d.target.Host }
+
+func (d sshDeployer) deploy(ctx context.Context, cert *Cert) error {
+	t := d.target
+	mode, err := parseFileMode(t.Mode, "SSHTarget.Mode")
+	if err != nil {
+		return err
+	}
+
+	client, err := dialSSH(ctx, t)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Closing the client aborts a blocked session when ctx is done.
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	leafPEM, _, err := cert.SplitChain()
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		path string
+		data []byte
+	}{
+		{t.CertPath, leafPEM},
+		{t.FullchainPath, []byte(cert.CertificateChain)},
+		{t.CombinedPath, cert.CombinedPEM()},
+		{t.KeyPath, []byte(cert.PrivateKey)},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		// Write next to the destination and rename, so a reader never sees a
+		// partial file.
+		tmp := f.path + ".acme-tmp"
+		cmd := fmt.Sprintf("umask 077 && cat > %s && chmod %o %s && mv -f %s %s",
+			shellQuote(tmp), mode, shellQuote(tmp), shellQuote(tmp), shellQuote(f.path))
+		if err := runSSH(client, cmd, f.data); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", f.path, err)
+		}
+	}
+
+	if t.ReloadCommand != "" {
+		if err := runSSH(client, t.ReloadCommand, nil); err != nil {
+			return fmt.Errorf("reload command failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// dialSSH connects and authenticates to t, verifying its host key.
+func dialSSH(ctx context.Context, t SSHTarget) (*ssh.Client, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(t.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH private key: %w", err)
+	}
+
+	knownHostsFile := t.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("no KnownHostsFile configured and home directory unknown: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	addr := t.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH handshake with %s failed: %w", addr, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// runSSH runs cmd in a new session with stdin as its input. The remote
+// stderr is included in the error.
+func runSSH(client *ssh.Client, cmd string, stdin []byte) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(stdin)
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,39 @@
+package acme
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// ConfigReader is the read side of config.SecureStore: the handler reads
+// acme_config related state, the previous certificate and the application
+// config through it.
+type ConfigReader interface {
+	Get(scope string, generation int) ([]byte, string, error)
+}
+
+// CertSaver is the write side of config.SecureStore: the handler saves
+// certificates, deployment reports, timings and alert state through it.
+type CertSaver interface {
+	Save(scope string, plaintextData []byte, format string, description string) error
+}
+
+// splitStore is the config.SecureStore of a handler built from a separate
+// ConfigReader and CertSaver.
+type splitStore struct {
+	ConfigReader
+	CertSaver
+}
+
+// NewCertRenewalHandlerWithStores is NewCertRenewalHandler with the reads
+// and writes of the handler going to separate stores, so a deployment can
+// give the renewal runner a read-only config source and a write-only
+// certificate sink, e.g. a SecureStore that encrypts to an age recipient
+// whose identity the runner does not hold. Versions the source cannot read,
+// such as earlier certificates in the sink, are treated as missing.
+func NewCertRenewalHandlerWithStores(cfg *Config, source ConfigReader, sink CertSaver, logger *slog.Logger) (*CertRenewalHandler, error) {
+	if source == nil || sink == nil {
+		return nil, fmt.Errorf("NewCertRenewalHandlerWithStores: received nil source or sink")
+	}
+	return NewCertRenewalHandler(cfg, splitStore{ConfigReader: source, CertSaver: sink}, logger)
+}
@@ -0,0 +1,144 @@
+package acme
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ScopeAcmeTimings is the scope of the RenewalTimings saved after each
+// certificate order.
+const ScopeAcmeTimings = "acme_timings"
+
+// RenewalTimings records how long the phases of one certificate order took,
+// for tuning DNS propagation timeouts. Durations are in seconds; a phase not
+// reached is zero.
+type RenewalTimings struct {
+	Identifier string
+	At         time.Time // UTC end of the order
+	Succeeded  bool
+	// First propagation check until the challenge records were seen on the
+	// authoritative nameservers, or until lego gave up waiting.
+	DNSPropagationSeconds float64
+	// Challenge cleanup until the certificate was downloaded: order
+	// finalization with the CSR and polling for issuance.
+	FinalizationSeconds float64
+	// The whole order, from creation to the downloaded certificate.
+	IssuanceSeconds float64
+}
+
+// phaseTimer collects the phase boundaries of one order from the lego
+// callbacks.
+type phaseTimer struct {
+	mu            sync.Mutex
+	start         time.Time
+	checkStart    time.Time
+	checkEnd      time.Time
+	lastCleanedUp time.Time
+}
+
+// begin marks the creation of the order.
+func (t *phaseTimer) begin() {
+	t.mu.Lock()
+	t.start = time.Now()
+	t.mu.Unlock()
+}
+
+// preCheckOption wraps the lego DNS propagation check to time it.
+func (t *phaseTimer) preCheckOption() dns01.ChallengeOption {
+	return dns01.WrapPreCheck(func(domain, fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
+		t.mu.Lock()
+		if t.checkStart.IsZero() {
+			t.checkStart = time.Now()
+		}
+		t.mu.Unlock()
+
+		ok, err := check(fqdn, value)
+
+		t.mu.Lock()
+		t.checkEnd = time.Now()
+		t.mu.Unlock()
+		return ok, err
+	})
+}
+
+func (t *phaseTimer) cleanedUp() {
+	t.mu.Lock()
+	t.lastCleanedUp = time.Now()
+	t.mu.Unlock()
+}
+
+// timings returns the phases of the order of identifier ending now.
+func (t *phaseTimer) timings(identifier string, succeeded bool) RenewalTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	end := time.Now()
+	rt := RenewalTimings{
+		Identifier:      identifier,
+		At:              end.UTC(),
+		Succeeded:       succeeded,
+		IssuanceSeconds: end.Sub(t.start).Seconds(),
+	}
+	if !t.checkStart.IsZero() {
+		rt.DNSPropagationSeconds = t.checkEnd.Sub(t.checkStart).Seconds()
+	}
+	if succeeded && !t.lastCleanedUp.IsZero() {
+		rt.FinalizationSeconds = end.Sub(t.lastCleanedUp).Seconds()
+	}
+	return rt
+}
+
+// recordTimings logs, exports and saves the phase timings of an order.
+// Failures to save are logged, they never change the outcome of the job.
+func (h *Renewer) recordTimings(rt RenewalTimings) {
+	h.logger.Info("Certificate order timings",
+		"identifier", rt.Identifier,
+		"succeeded", rt.Succeeded,
+		"dns_propagation", secondsDuration(rt.DNSPropagationSeconds),
+		"finalization", secondsDuration(rt.FinalizationSeconds),
+		"issuance", secondsDuration(rt.IssuanceSeconds))
+	h.metrics.observePhases(rt)
+	if err := SaveRenewalTimings(h.secureConfigStore, rt); err != nil {
+		h.logger.Error("Failed to save renewal timings", "error", err)
+	}
+}
+
+// SaveRenewalTimings saves rt as the latest version of ScopeAcmeTimings.
+func SaveRenewalTimings(store CertSaver, rt RenewalTimings) error {
+	data, err := toml.Marshal(rt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal renewal timings: %w", err)
+	}
+	description := fmt.Sprintf("Order timings of %s (issuance %s)", rt.Identifier, secondsDuration(rt.IssuanceSeconds))
+	if err := store.Save(ScopeAcmeTimings, data, "toml", description); err != nil {
+		return fmt.Errorf("failed to save renewal timings to scope '%s': %w", ScopeAcmeTimings, err)
+	}
+	return nil
+}
+
+// LastRenewalTimings returns the most recently saved RenewalTimings, or nil
+// when none was saved yet.
+func LastRenewalTimings(store ConfigReader) (*RenewalTimings, error) {
+	data, format, err := store.Get(ScopeAcmeTimings, 0)
+	if scopeEmpty(data, err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load renewal timings from scope '%s': %w", ScopeAcmeTimings, err)
+	}
+	if format != "toml" {
+		return nil, fmt.Errorf("renewal timings in scope '%s' are in format '%s', expected 'toml'", ScopeAcmeTimings, format)
+	}
+	var rt RenewalTimings
+	if err := toml.Unmarshal(data, &rt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal renewal timings: %w", err)
+	}
+	return &rt, nil
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
@@ -0,0 +1,40 @@
+package acme
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// modulePath is the import path of this module, looked up in the build info
+// for the version in the User-Agent.
+const modulePath = "github.com/caasmo/restinpieces-acme"
+
+// UserAgent returns the User-Agent product of this package, e.g.
+// "restinpieces-acme/v1.2.0", sent with every ACME request so CA logs and
+// rate limit investigations can tell this client apart. The version is
+// "devel" when the binary was not built from a tagged module version.
+func UserAgent() string {
+	version := "devel"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		mod := &info.Main
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				mod = dep
+			}
+		}
+		if mod.Path == modulePath && mod.Version != "" && mod.Version != "(devel)" {
+			version = mod.Version
+		}
+	}
+	return "restinpieces-acme/" + version
+}
+
+// userAgent returns the User-Agent of the ACME requests for cfg: its
+// UserAgent products, if any, followed by the one of this package. lego
+// appends its own product and the platform.
+func userAgent(cfg *Config) string {
+	if custom := strings.TrimSpace(cfg.UserAgent); custom != "" {
+		return custom + " " + UserAgent()
+	}
+	return UserAgent()
+}
@@ -0,0 +1,155 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// the request body keyed with Webhook.Secret.
+	WebhookSignatureHeader = "X-Acme-Signature"
+	// WebhookTimestampHeader carries the Unix time the request was signed
+	// at, included in the HMAC input as "<timestamp>.<body>" so receivers
+	// can reject replays.
+	WebhookTimestampHeader = "X-Acme-Timestamp"
+
+	// DefaultWebhookTimeout bounds a Webhook delivery without a Timeout.
+	DefaultWebhookTimeout = 30 * time.Second
+)
+
+// Webhook is an HTTPS endpoint the renewed certificate is POSTed to as JSON,
+// so external systems can subscribe to renewals. The private key is only
+// sent when AgeRecipient is set, encrypted to that recipient.
+type Webhook struct {
+	URL          string
+	Secret       string // HMAC-SHA256 signing key
+	AgeRecipient string `toml:",omitempty"` // age1... public key; the private key is sent encrypted to it
+	Timeout      string `toml:",omitempty"` // Go duration (default "30s")
+}
+
+// WebhookPayload is the JSON body of a Webhook delivery.
+type WebhookPayload struct {
+	Identifier        string    `json:"identifier"`
+	Domains           []string  `json:"domains"`
+	IssuedAt          time.Time `json:"issued_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	SerialNumber      string    `json:"serial_number"`
+	FingerprintSHA256 string    `json:"fingerprint_sha256"`
+	CertificateChain  string    `json:"certificate_chain"`
+	// ASCII armored age ciphertext of the PEM private key, empty unless the
+	// Webhook has an AgeRecipient.
+	EncryptedPrivateKey string `json:"encrypted_private_key,omitempty"`
+}
+
+// webhookDeployer delivers the certificate to one Webhook.
+type webhookDeployer struct {
+	hook Webhook
+}
+
+func (d webhookDeployer) name() string { return "webhook:" + d.hook.URL }
+
+func (d webhookDeployer) deploy(ctx context.Context, cert *Cert) error {
+	u, err := url.Parse(d.hook.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid Webhook.URL '%s', want an https:// URL", d.hook.URL)
+	}
+	if d.hook.Secret == "" {
+		return fmt.Errorf("Webhook.Secret is required")
+	}
+	timeout := DefaultWebhookTimeout
+	if d.hook.Timeout != "" {
+		if timeout, err = time.ParseDuration(d.hook.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid Webhook.Timeout '%s', want a positive duration like 30s", d.hook.Timeout)
+		}
+	}
+
+	payload := WebhookPayload{
+		Identifier:        cert.Identifier,
+		Domains:           cert.Domains,
+		IssuedAt:          cert.IssuedAt,
+		ExpiresAt:         cert.ExpiresAt,
+		SerialNumber:      cert.SerialNumber,
+		FingerprintSHA256: cert.FingerprintSHA256,
+		CertificateChain:  cert.CertificateChain,
+	}
+	if d.hook.AgeRecipient != "" {
+		if payload.EncryptedPrivateKey, err = encryptToAge(d.hook.AgeRecipient, []byte(cert.PrivateKey)); err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(d.hook.Secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// secret, as sent in WebhookSignatureHeader. Receivers recompute it and
+// compare with hmac.Equal.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encryptToAge encrypts data to an age X25519 recipient, ASCII armored.
+func encryptToAge(recipient string, data []byte) (string, error) {
+	r, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return "", fmt.Errorf("invalid Webhook.AgeRecipient: %w", err)
+	}
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,43 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+)
+
+// Zeroize overwrites b with zeros. Decrypted configs, PEM private keys and
+// secrets read from files are zeroized once parsed, shortening the time
+// they can end up in core dumps or swap. It is best effort: Go strings
+// (e.g. the DNS tokens of Config) are immutable and the garbage collector
+// may have copied a slice before, so only the buffers held here are wiped.
+func Zeroize(b []byte) {
+	clear(b)
+}
+
+// zeroizeKey overwrites the private scalar of an RSA, ECDSA or Ed25519 key
+// that is no longer used. Other key types are left as is.
+func zeroizeKey(key crypto.PrivateKey) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		if k.D != nil {
+			clear(k.D.Bits())
+		}
+	case *rsa.PrivateKey:
+		if k.D != nil {
+			clear(k.D.Bits())
+		}
+		for _, p := range k.Primes {
+			clear(p.Bits())
+		}
+		for _, v := range []*big.Int{k.Precomputed.Dp, k.Precomputed.Dq, k.Precomputed.Qinv} {
+			if v != nil {
+				clear(v.Bits())
+			}
+		}
+	case ed25519.PrivateKey:
+		clear(k)
+	}
+}